@@ -0,0 +1,32 @@
+// fake-translator serves the translation APIs Niete supports with canned
+// answers, so the translation flow can be tried without network access or
+// API keys. Point the bot at it with, for example:
+//
+//	TRANSLATORS=deepl-free,libretranslate,deeplx
+//	DEEPL_KEY=fake
+//	DEEPL_URL=http://localhost:8090/v2/translate
+//	LIBRETRANSLATE_URL=http://localhost:8090
+//	DEEPLX_URL=http://localhost:8090/deeplx/translate
+//
+// Text with non-ASCII characters is detected as Japanese and everything else
+// as English. The translation is the text with a "[EN]" prefix.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/Jrryy/Niete/internal/faketranslator"
+)
+
+func main() {
+	address := flag.String("addr", "localhost:8090", "address to listen on")
+	options := &faketranslator.Options{}
+	flag.BoolVar(&options.DeepLQuotaExceeded, "deepl-quota-exceeded", false, "answer every DeepL request with 456 Quota Exceeded")
+	flag.BoolVar(&options.LibreTranslateDown, "libretranslate-down", false, "answer every LibreTranslate request with 503")
+	flag.Parse()
+
+	log.Println("Fake translator listening on", *address)
+	log.Fatal(http.ListenAndServe(*address, faketranslator.Handler(options)))
+}
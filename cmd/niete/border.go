@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// A crew snapshot older than this is not used to estimate the border.
+	snapshotMaxAge = 2 * time.Hour
+	// Only the estimates of the last hours are used for the trend.
+	borderTrendWindow = 6 * time.Hour
+	borderStep        = time.Hour
+)
+
+type crewSnapshot struct {
+	CrewId      string    `bson:"crewId"`
+	Taken       time.Time `bson:"taken"`
+	Rank        int64     `bson:"rank"`
+	TotalHonors int64     `bson:"totalHonors"`
+}
+
+type borderPrediction struct {
+	Number    int       `bson:"number"`
+	Tier      int64     `bson:"tier"`
+	Made      time.Time `bson:"made"`
+	Predicted int64     `bson:"predicted"`
+}
+
+type borderPoint struct {
+	Time   time.Time
+	Honors float64
+}
+
+// recordCrewSnapshot stores the rank and honors of a crew every time they
+// change, so that borders can be estimated from them later. The totals of a
+// day are final once it is over, so they are stored as taken at its cutoff.
+// Until then, they are the ones of when they were fetched.
+func recordCrewSnapshot(crewId string, rounds [][]string, fetched time.Time) {
+	round := latestRound(rounds)
+	if round == nil {
+		return
+	}
+	rank, _, total := parseRound(round)
+	if rank == 0 || total == 0 {
+		return
+	}
+	taken := fetched
+	if cutoff, ok := roundCutoff(round, fetched); ok && cutoff.Before(fetched) {
+		taken = cutoff
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("crewSnapshots").UpdateOne(
+		ctx,
+		bson.M{"crewId": crewId, "totalHonors": total},
+		bson.M{"$setOnInsert": bson.M{"taken": taken, "rank": rank}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		logger.Printf("Could not record a snapshot of crew %s: %v\n", crewId, err)
+	}
+}
+
+// getCrewSnapshots returns the snapshots needed to estimate borders between
+// from and to.
+func getCrewSnapshots(from, to time.Time) ([]crewSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := getDatabase().Collection("crewSnapshots").Find(
+		ctx,
+		bson.M{"taken": bson.M{"$gte": from.Add(-snapshotMaxAge), "$lte": to}},
+		options.Find().SetSort(bson.M{"taken": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []crewSnapshot
+	err = cursor.All(ctx, &snapshots)
+	return snapshots, err
+}
+
+// estimateBorder interpolates the honors of the crew ranked at tier at the
+// given time, using the latest snapshot of every crew before then. It returns
+// false if there are not crews on both sides of the border.
+func estimateBorder(snapshots []crewSnapshot, tier int64, at time.Time) (float64, bool) {
+	latest := make(map[string]crewSnapshot)
+	for _, snapshot := range snapshots {
+		if snapshot.Taken.After(at) || at.Sub(snapshot.Taken) > snapshotMaxAge {
+			continue
+		}
+		latest[snapshot.CrewId] = snapshot
+	}
+	var above, below *crewSnapshot
+	for _, snapshot := range latest {
+		if snapshot.Rank <= tier && (above == nil || snapshot.Rank > above.Rank) {
+			above = &snapshot
+		}
+		if snapshot.Rank > tier && (below == nil || snapshot.Rank < below.Rank) {
+			below = &snapshot
+		}
+	}
+	if above == nil || below == nil {
+		return 0, false
+	}
+	if above.Rank == tier {
+		return float64(above.TotalHonors), true
+	}
+	ratio := float64(tier-above.Rank) / float64(below.Rank-above.Rank)
+	return float64(above.TotalHonors) + ratio*float64(below.TotalHonors-above.TotalHonors), true
+}
+
+// borderHistory estimates the border every borderStep from start until end.
+func borderHistory(snapshots []crewSnapshot, tier int64, start, end time.Time) []borderPoint {
+	var points []borderPoint
+	for at := start.Add(borderStep); !at.After(end); at = at.Add(borderStep) {
+		if honors, ok := estimateBorder(snapshots, tier, at); ok {
+			points = append(points, borderPoint{Time: at, Honors: honors})
+		}
+	}
+	if honors, ok := estimateBorder(snapshots, tier, end); ok {
+		points = append(points, borderPoint{Time: end, Honors: honors})
+	}
+	return points
+}
+
+// projectBorder fits a line to the recent estimates and extends it until the
+// given time. Honors never go down, so neither does the projection.
+func projectBorder(points []borderPoint, until time.Time) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+	last := points[len(points)-1]
+	var recent []borderPoint
+	for _, point := range points {
+		if last.Time.Sub(point.Time) <= borderTrendWindow {
+			recent = append(recent, point)
+		}
+	}
+	if len(recent) < 2 {
+		return 0, false
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, point := range recent {
+		x := point.Time.Sub(last.Time).Hours()
+		sumX += x
+		sumY += point.Honors
+		sumXY += x * point.Honors
+		sumXX += x * x
+	}
+	n := float64(len(recent))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	slope := math.Max(0, (n*sumXY-sumX*sumY)/denominator)
+	return last.Honors + slope*until.Sub(last.Time).Hours(), true
+}
+
+func parseTier(value string) (int64, error) {
+	honors, err := parseHonors(value)
+	if err != nil {
+		return 0, err
+	}
+	for _, tier := range rankTiers {
+		if tier == int64(honors) {
+			return tier, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tier %q", value)
+}
+
+// predictionAccuracy describes how far off the predictions made for past GWs
+// were from the border they ended up at.
+func predictionAccuracy(tier int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := getDatabase().Collection("gwSchedules").Find(
+		ctx,
+		bson.M{"prelimsEnd": bson.M{"$lte": time.Now()}},
+		options.Find().SetSort(bson.M{"prelimsEnd": -1}).SetLimit(3),
+	)
+	if err != nil {
+		return "", err
+	}
+	var schedules []gwSchedule
+	if err = cursor.All(ctx, &schedules); err != nil {
+		return "", err
+	}
+	seen := make(map[int]bool)
+	var lines []string
+	for _, schedule := range schedules {
+		if seen[schedule.Number] {
+			continue
+		}
+		seen[schedule.Number] = true
+		// gbfdata publishes the final totals a while after the cutoff.
+		settled := schedule.PrelimsEnd.Add(time.Hour)
+		snapshots, err := getCrewSnapshots(settled, settled)
+		if err != nil {
+			return "", err
+		}
+		actual, ok := estimateBorder(snapshots, tier, settled)
+		if !ok {
+			continue
+		}
+		predictionsCursor, err := getDatabase().Collection("borderPredictions").Find(
+			ctx,
+			bson.M{"number": schedule.Number, "tier": tier},
+		)
+		if err != nil {
+			return "", err
+		}
+		var predictions []borderPrediction
+		if err = predictionsCursor.All(ctx, &predictions); err != nil {
+			return "", err
+		}
+		if len(predictions) == 0 {
+			continue
+		}
+		var totalError float64
+		for _, prediction := range predictions {
+			totalError += math.Abs(float64(prediction.Predicted)-actual) / actual
+		}
+		lines = append(lines, fmt.Sprintf(
+			"GW #%d: ended at ~%s, %d predictions were off by %.1f%% on average.",
+			schedule.Number, intComma(int(actual)), len(predictions), 100*totalError/float64(len(predictions)),
+		))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func sendBorderEstimate(session *dgo.Session, channel, crewId string, args []string) error {
+	tiers := rankTiers
+	if len(args) > 0 {
+		tier, err := parseTier(args[0])
+		if err != nil {
+			_, err = session.ChannelMessageSend(channel, fmt.Sprintf("Usage: `$gw border [tier]`, with tier one of %v.", rankTiers))
+			return err
+		}
+		tiers = []int64{tier}
+	}
+
+	now := time.Now()
+	start := now.Add(-48 * time.Hour)
+	schedule, err := getLatestGWSchedule(crewId)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if schedule != nil && schedule.PrelimsStart.Before(now) {
+		start = schedule.PrelimsStart
+	}
+
+	var ourTotal int64
+	if crewId != "" {
+		rounds, err := getLastRoundsPerformance(crewId)
+		if err != nil {
+			logger.Printf("Could not get our last rounds for the border estimate: %v\n", err)
+		} else if round := latestRound(rounds); round != nil {
+			_, _, ourTotal = parseRound(round)
+		}
+	}
+
+	snapshots, err := getCrewSnapshots(start, now)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+
+	embed := &dgo.MessageEmbed{Title: "GW border estimate"}
+	predicting := schedule != nil && now.Before(schedule.PrelimsEnd)
+	for _, tier := range tiers {
+		points := borderHistory(snapshots, tier, start, now)
+		name := "Top " + intComma(int(tier))
+		if len(points) == 0 {
+			embed.Fields = append(embed.Fields, &dgo.MessageEmbedField{
+				Name:  name,
+				Value: "Not enough data. Watch some crews around this rank with `$gw watch`.",
+			})
+			continue
+		}
+		current := points[len(points)-1].Honors
+		value := fmt.Sprintf("Now: ~%s", intComma(int(current)))
+		target := current
+		if predicting {
+			if projected, ok := projectBorder(points, schedule.PrelimsEnd); ok {
+				target = projected
+				value += fmt.Sprintf(
+					"\nProjected at the end of prelims (%s JST): ~%s",
+					schedule.PrelimsEnd.In(jst).Format("Jan 2 15:04"),
+					intComma(int(projected)),
+				)
+				// Only the latest prediction of every hour is kept, so that
+				// asking often does not weigh more in the accuracy.
+				prediction := borderPrediction{
+					Number:    schedule.Number,
+					Tier:      tier,
+					Made:      now.Truncate(time.Hour),
+					Predicted: int64(projected),
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				_, err = getDatabase().Collection("borderPredictions").ReplaceOne(
+					ctx,
+					bson.M{"number": prediction.Number, "tier": prediction.Tier, "made": prediction.Made},
+					prediction,
+					options.Replace().SetUpsert(true),
+				)
+				cancel()
+				if err != nil {
+					logger.Printf("Could not store the border prediction: %v\n", err)
+				}
+			}
+		}
+		if ourTotal > 0 {
+			value += fmt.Sprintf("\nOur crew: %s (%s)", intComma(int(ourTotal)), signedIntComma(ourTotal-int64(target)))
+		}
+		accuracy, err := predictionAccuracy(tier)
+		if err != nil {
+			logger.Printf("Could not check past border predictions: %v\n", err)
+		} else if accuracy != "" {
+			value += "\n" + accuracy
+		}
+		embed.Fields = append(embed.Fields, &dgo.MessageEmbedField{Name: name, Value: value})
+	}
+	embed.Footer = &dgo.MessageEmbedFooter{
+		Text: fmt.Sprintf("Based on %d snapshots of the crews the bot has looked up or watched.", len(snapshots)),
+	}
+	_, err = session.ChannelMessageSendEmbed(channel, embed)
+	return err
+}
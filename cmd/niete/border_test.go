@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateBorder(t *testing.T) {
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	snapshots := []crewSnapshot{
+		{CrewId: "old", Taken: at.Add(-3 * time.Hour), Rank: 14, TotalHonors: 5000},
+		{CrewId: "a", Taken: at.Add(-time.Hour), Rank: 12, TotalHonors: 900},
+		{CrewId: "a", Taken: at.Add(-30 * time.Minute), Rank: 10, TotalHonors: 1000},
+		{CrewId: "b", Taken: at.Add(-30 * time.Minute), Rank: 20, TotalHonors: 500},
+		{CrewId: "later", Taken: at.Add(time.Minute), Rank: 15, TotalHonors: 5000},
+	}
+	tests := []struct {
+		name   string
+		tier   int64
+		want   float64
+		wantOk bool
+	}{
+		{name: "between two crews", tier: 15, want: 750, wantOk: true},
+		{name: "on a crew", tier: 10, want: 1000, wantOk: true},
+		{name: "nobody above", tier: 5},
+		{name: "nobody below", tier: 20},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := estimateBorder(snapshots, test.tier, at)
+			if ok != test.wantOk || got != test.want {
+				t.Errorf("got %v, %v, want %v, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestProjectBorder(t *testing.T) {
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	hours := func(honors ...float64) []borderPoint {
+		points := make([]borderPoint, len(honors))
+		for i, h := range honors {
+			points[i] = borderPoint{Time: start.Add(time.Duration(i) * time.Hour), Honors: h}
+		}
+		return points
+	}
+	tests := []struct {
+		name   string
+		points []borderPoint
+		until  time.Duration
+		want   float64
+		wantOk bool
+	}{
+		{name: "no points"},
+		{name: "one point", points: hours(100)},
+		{name: "steady", points: hours(0, 100, 200), until: 5 * time.Hour, want: 500, wantOk: true},
+		{name: "never down", points: hours(300, 200, 100), until: 5 * time.Hour, want: 100, wantOk: true},
+		{
+			// Only the last six hours count.
+			name:   "recent trend",
+			points: hours(900, 900, 100, 200, 300, 400, 500, 600, 700),
+			until:  10 * time.Hour,
+			want:   900,
+			wantOk: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := projectBorder(test.points, start.Add(test.until))
+			if ok != test.wantOk || got != test.want {
+				t.Errorf("got %v, %v, want %v, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
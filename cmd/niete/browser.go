@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const (
+	browserPoolSize            = 3
+	browserHealthCheckInterval = time.Minute
+	browserHealthCheckTimeout  = 10 * time.Second
+	pageTimeout                = 30 * time.Second
+	// How long a page of the pool can take to go blank before it is reused.
+	pageResetTimeout = 5 * time.Second
+)
+
+// browserManager keeps a single headless Chromium running for everything that
+// needs to render a page, and hands out pages from a pool so that they can be
+// reused between requests. The browser is launched on first use and launched
+// again if it crashes.
+type browserManager struct {
+	mutex    sync.Mutex
+	launcher *launcher.Launcher
+	browser  *rod.Browser
+	pages    rod.Pool[rod.Page]
+}
+
+var browsers = &browserManager{}
+
+// get returns the running browser and its page pool, launching it if needed.
+func (m *browserManager) get() (*rod.Browser, rod.Pool[rod.Page], error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.browser != nil {
+		return m.browser, m.pages, nil
+	}
+
+	path, _ := launcher.LookPath()
+	browserLauncher := launcher.New().Bin(path).Headless(true)
+	controlURL, err := browserLauncher.Launch()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not launch the browser: %w", err)
+	}
+	browser := rod.New().ControlURL(controlURL)
+	if err = browser.Connect(); err != nil {
+		browserLauncher.Kill()
+		return nil, nil, fmt.Errorf("could not connect to the browser: %w", err)
+	}
+	logger.Println("Browser launched.")
+	m.launcher = browserLauncher
+	m.browser = browser
+	m.pages = rod.NewPagePool(browserPoolSize)
+	return m.browser, m.pages, nil
+}
+
+// stopLocked closes the browser, if it is running. The mutex must be held.
+func (m *browserManager) stopLocked() {
+	if m.browser == nil {
+		return
+	}
+	if err := m.browser.Close(); err != nil {
+		logger.Printf("Could not close the browser cleanly: %v\n", err)
+	}
+	m.launcher.Kill()
+	m.browser = nil
+	m.launcher = nil
+	m.pages = nil
+}
+
+func (m *browserManager) stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stopLocked()
+}
+
+// healthCheck makes sure the browser still responds, and stops it if it does
+// not so that the next request launches a new one.
+func (m *browserManager) healthCheck() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.browser == nil {
+		return nil
+	}
+	if _, err := m.browser.Timeout(browserHealthCheckTimeout).Version(); err != nil {
+		logger.Printf("The browser is not responding, restarting it: %v\n", err)
+		m.stopLocked()
+	}
+	return nil
+}
+
+// withPage opens url in a page from the pool and runs render on it. Both have
+// to finish before timeout.
+func (m *browserManager) withPage(url string, timeout time.Duration, render func(page *rod.Page) error) error {
+	browser, pages, err := m.get()
+	if err != nil {
+		return err
+	}
+	page, err := pages.Get(func() (*rod.Page, error) { return browser.Page(proto.TargetCreateTarget{}) })
+	if err != nil {
+		pages.Put(nil)
+		m.healthCheck()
+		return err
+	}
+
+	timedPage := page.Timeout(timeout)
+	err = timedPage.Navigate(url)
+	if err == nil {
+		err = render(timedPage)
+	}
+	timedPage.CancelTimeout()
+
+	// Pages that failed may be stuck in the middle of something, so they are
+	// replaced instead of reused.
+	if err != nil || resetPage(page) != nil {
+		page.Close()
+		pages.Put(nil)
+		m.healthCheck()
+		return err
+	}
+	pages.Put(page)
+	return nil
+}
+
+// resetPage leaves a page blank so that it can be reused.
+func resetPage(page *rod.Page) error {
+	timedPage := page.Timeout(pageResetTimeout)
+	defer timedPage.CancelTimeout()
+	return timedPage.Navigate("about:blank")
+}
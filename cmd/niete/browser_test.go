@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+func TestBrowserWithPage(t *testing.T) {
+	if _, found := launcher.LookPath(); !found {
+		t.Skip("no browser installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><body><h1>%s</h1></body></html>", r.URL.Path[1:])
+	}))
+	t.Cleanup(server.Close)
+	manager := &browserManager{}
+	t.Cleanup(manager.stop)
+
+	heading := func(path string) (string, error) {
+		var text string
+		err := manager.withPage(server.URL+"/"+path, pageTimeout, func(page *rod.Page) error {
+			element, err := page.Element("h1")
+			if err != nil {
+				return err
+			}
+			text, err = element.Text()
+			return err
+		})
+		return text, err
+	}
+	for _, path := range []string{"first", "second"} {
+		if got, err := heading(path); err != nil || got != path {
+			t.Errorf("rendered %q, %v, want %q", got, err, path)
+		}
+	}
+
+	// A failed render gives its page up, and the next one gets a new page.
+	failure := errors.New("render failed")
+	err := manager.withPage(server.URL+"/broken", pageTimeout, func(page *rod.Page) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, want the render error", err)
+	}
+	if got, err := heading("third"); err != nil || got != "third" {
+		t.Errorf("rendered %q, %v after a failure", got, err)
+	}
+
+	// Pages that do not load in time fail instead of holding their slot.
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	t.Cleanup(slow.Close)
+	err = manager.withPage(slow.URL, 500*time.Millisecond, func(page *rod.Page) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v for a page that did not load in time", err)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type configuredCrew struct {
+	Alias  string `bson:"alias"`
+	CrewId string `bson:"crewId"`
+}
+
+// guildCrews are the crews a server cares about. The home crew is the one
+// used by default, and channels can override it with their own.
+type guildCrews struct {
+	GuildId  string            `bson:"guildId"`
+	Home     string            `bson:"home"`
+	Crews    []configuredCrew  `bson:"crews"`
+	Channels map[string]string `bson:"channels"`
+}
+
+func isAdmin(session *dgo.Session, channel, userId string) bool {
+	permissions, err := session.UserChannelPermissions(userId, channel)
+	if err != nil {
+		logger.Printf("Could not get the permissions of %s: %v\n", userId, err)
+		return false
+	}
+	return permissions&(dgo.PermissionAdministrator|dgo.PermissionManageServer) != 0
+}
+
+func getGuildCrews(guild string) (*guildCrews, error) {
+	crews := &guildCrews{GuildId: guild, Channels: map[string]string{}}
+	if guild == "" {
+		return crews, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := getDatabase().Collection("guildCrews").FindOne(ctx, bson.M{"guildId": guild}).Decode(crews)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if crews.Channels == nil {
+		crews.Channels = map[string]string{}
+	}
+	return crews, nil
+}
+
+func saveGuildCrews(crews *guildCrews) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("guildCrews").ReplaceOne(
+		ctx,
+		bson.M{"guildId": crews.GuildId},
+		crews,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// find returns the ID of the configured crew with the given alias or ID.
+func (g *guildCrews) find(aliasOrId string) (string, bool) {
+	for _, crew := range g.Crews {
+		if strings.EqualFold(crew.Alias, aliasOrId) || crew.CrewId == aliasOrId {
+			return crew.CrewId, true
+		}
+	}
+	return "", false
+}
+
+func (g *guildCrews) alias(crewId string) string {
+	for _, crew := range g.Crews {
+		if crew.CrewId == crewId {
+			return crew.Alias
+		}
+	}
+	return crewId
+}
+
+// homeCrew returns the crew used by default in a channel: the channel's own
+// crew, the server's home crew or MY_CREW, in that order.
+func homeCrew(guild, channel string) string {
+	crews, err := getGuildCrews(guild)
+	if err != nil {
+		logger.Printf("Could not get the crews of guild %s: %v\n", guild, err)
+		return myCrew
+	}
+	if crewId, ok := crews.Channels[channel]; ok {
+		return crewId
+	}
+	if crews.Home != "" {
+		return crews.Home
+	}
+	return myCrew
+}
+
+// resolveCrew returns the crew picked with an alias, or the channel's home
+// crew if there is no alias.
+func resolveCrew(guild, channel, alias string) (string, error) {
+	if alias == "" {
+		return homeCrew(guild, channel), nil
+	}
+	crews, err := getGuildCrews(guild)
+	if err != nil {
+		return "", err
+	}
+	if crewId, ok := crews.find(alias); ok {
+		return crewId, nil
+	}
+	return "", fmt.Errorf("unknown crew %q", alias)
+}
+
+// extractCrewOption removes "--crew <alias>" from the arguments of a command
+// and returns the alias.
+func extractCrewOption(args []string) ([]string, string) {
+	index := slices.Index(args, "--crew")
+	if index < 0 || index+1 >= len(args) {
+		return args, ""
+	}
+	alias := args[index+1]
+	return slices.Delete(slices.Clone(args), index, index+2), alias
+}
+
+// allConfiguredCrews returns every crew configured in any server, plus MY_CREW.
+func allConfiguredCrews() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := getDatabase().Collection("guildCrews").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var guilds []guildCrews
+	if err = cursor.All(ctx, &guilds); err != nil {
+		return nil, err
+	}
+	var crews []string
+	if myCrew != "" {
+		crews = append(crews, myCrew)
+	}
+	for _, guild := range guilds {
+		for _, crew := range guild.Crews {
+			if !slices.Contains(crews, crew.CrewId) {
+				crews = append(crews, crew.CrewId)
+			}
+		}
+	}
+	return crews, nil
+}
+
+func sendGuildCrews(session *dgo.Session, channel string, crews *guildCrews) error {
+	if len(crews.Crews) == 0 {
+		message := "There are no crews configured in this server. Use `$crew add <alias> <crew id>`."
+		if myCrew != "" {
+			message += fmt.Sprintf("\nUntil then, crew `%s` is used.", myCrew)
+		}
+		_, err := session.ChannelMessageSend(channel, message)
+		return err
+	}
+	message := "Crews:\n"
+	for _, crew := range crews.Crews {
+		message += fmt.Sprintf("- %s: `%s`", crew.Alias, crew.CrewId)
+		if crew.CrewId == crews.Home {
+			message += " (home)"
+		}
+		message += "\n"
+	}
+	for channelId, crewId := range crews.Channels {
+		message += fmt.Sprintf("<#%s> uses %s\n", channelId, crews.alias(crewId))
+	}
+	_, err := session.ChannelMessageSend(channel, message)
+	return err
+}
+
+func crewHandler(session *dgo.Session, channel, guild, userId string, args []string) error {
+	if guild == "" {
+		_, err := session.ChannelMessageSend(channel, "Crews can only be configured in a server.")
+		return err
+	}
+	crews, err := getGuildCrews(guild)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		return sendGuildCrews(session, channel, crews)
+	}
+	if !isAdmin(session, channel, userId) {
+		_, err = session.ChannelMessageSend(channel, "Only admins can configure the crews.")
+		return err
+	}
+
+	var reply string
+	switch {
+	case args[0] == "add" && len(args) == 3:
+		alias, crewId := args[1], args[2]
+		if _, err = strconv.ParseUint(crewId, 10, 64); err != nil {
+			_, err = session.ChannelMessageSend(channel, "Please input the crew's ID.")
+			return err
+		}
+		crews.Crews = slices.DeleteFunc(crews.Crews, func(crew configuredCrew) bool {
+			return strings.EqualFold(crew.Alias, alias) || crew.CrewId == crewId
+		})
+		crews.Crews = append(crews.Crews, configuredCrew{Alias: alias, CrewId: crewId})
+		if crews.Home == "" {
+			crews.Home = crewId
+		}
+		reply = fmt.Sprintf("Added %s (`%s`).", alias, crewId)
+	case args[0] == "remove" && len(args) == 2:
+		crewId, ok := crews.find(args[1])
+		if !ok {
+			_, err = session.ChannelMessageSend(channel, "That crew is not configured.")
+			return err
+		}
+		crews.Crews = slices.DeleteFunc(crews.Crews, func(crew configuredCrew) bool { return crew.CrewId == crewId })
+		if crews.Home == crewId {
+			crews.Home = ""
+		}
+		for channelId, channelCrew := range crews.Channels {
+			if channelCrew == crewId {
+				delete(crews.Channels, channelId)
+			}
+		}
+		reply = fmt.Sprintf("Removed %s.", args[1])
+	case args[0] == "set" && (len(args) == 2 || len(args) == 3 && args[2] == "here"):
+		crewId, ok := crews.find(args[1])
+		if !ok {
+			if _, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				_, err = session.ChannelMessageSend(channel, "That crew is not configured. Use `$crew add <alias> <crew id>`.")
+				return err
+			}
+			crewId = args[1]
+			crews.Crews = append(crews.Crews, configuredCrew{Alias: crewId, CrewId: crewId})
+		}
+		if len(args) == 3 {
+			crews.Channels[channel] = crewId
+			reply = fmt.Sprintf("This channel now uses %s.", crews.alias(crewId))
+		} else {
+			crews.Home = crewId
+			reply = fmt.Sprintf("The home crew of the server is now %s.", crews.alias(crewId))
+		}
+	case args[0] == "unset" && len(args) == 2 && args[1] == "here":
+		delete(crews.Channels, channel)
+		reply = "This channel now uses the home crew of the server."
+	default:
+		_, err = session.ChannelMessageSend(
+			channel,
+			"Usage: `$crew [list|add <alias> <crew id>|remove <alias>|set <alias|crew id> [here]|unset here]`",
+		)
+		return err
+	}
+
+	if err = saveGuildCrews(crews); err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = session.ChannelMessageSend(channel, reply)
+	return err
+}
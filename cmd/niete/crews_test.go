@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractCrewOption(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantArgs  []string
+		wantAlias string
+	}{
+		{args: nil, wantArgs: nil},
+		{args: []string{"report", "csv"}, wantArgs: []string{"report", "csv"}},
+		{args: []string{"report", "--crew", "alt", "csv"}, wantArgs: []string{"report", "csv"}, wantAlias: "alt"},
+		{args: []string{"--crew", "alt"}, wantArgs: []string{}, wantAlias: "alt"},
+		// Without an alias, the option is left for the command to complain.
+		{args: []string{"report", "--crew"}, wantArgs: []string{"report", "--crew"}},
+	}
+	for _, test := range tests {
+		args := slices.Clone(test.args)
+		gotArgs, gotAlias := extractCrewOption(args)
+		if !slices.Equal(gotArgs, test.wantArgs) || gotAlias != test.wantAlias {
+			t.Errorf("extractCrewOption(%q) = %q, %q, want %q, %q", test.args, gotArgs, gotAlias, test.wantArgs, test.wantAlias)
+		}
+		if !slices.Equal(args, test.args) {
+			t.Errorf("extractCrewOption(%q) changed its arguments to %q", test.args, args)
+		}
+	}
+}
+
+func TestGuildCrewsFind(t *testing.T) {
+	crews := &guildCrews{Crews: []configuredCrew{{Alias: "Main", CrewId: "111"}, {Alias: "alt", CrewId: "222"}}}
+	tests := []struct {
+		aliasOrId string
+		want      string
+		wantOk    bool
+	}{
+		{aliasOrId: "main", want: "111", wantOk: true},
+		{aliasOrId: "ALT", want: "222", wantOk: true},
+		{aliasOrId: "222", want: "222", wantOk: true},
+		{aliasOrId: "333"},
+	}
+	for _, test := range tests {
+		got, ok := crews.find(test.aliasOrId)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("find(%q) = %q, %v, want %q, %v", test.aliasOrId, got, ok, test.want, test.wantOk)
+		}
+	}
+	if got := crews.alias("222"); got != "alt" {
+		t.Errorf("alias(222) = %q", got)
+	}
+	if got := crews.alias("333"); got != "333" {
+		t.Errorf("alias(333) = %q", got)
+	}
+}
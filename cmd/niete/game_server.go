@@ -0,0 +1,638 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type serverState string
+
+const (
+	serverStopped  serverState = "stopped"
+	serverStarting serverState = "starting"
+	serverRunning  serverState = "running"
+	serverStopping serverState = "stopping"
+	// The server or its tunnel died without anyone stopping them.
+	serverCrashed serverState = "crashed"
+)
+
+const (
+	serverStopTimeout = time.Minute
+	processPollPeriod = 5 * time.Second
+	// How long a process can take to go away after SIGKILL.
+	processKillTimeout = 10 * time.Second
+	serverStartupError = "Something went wrong with the server startup. Ping my creator."
+	serverStopError    = "Something went wrong stopping the server. Ping my creator."
+)
+
+// serverRecord is the state of a server as stored in MongoDB, so that the bot
+// can pick up the processes it left running when it restarts.
+type serverRecord struct {
+	Name      string      `bson:"name"`
+	State     serverState `bson:"state"`
+	TunnelPid int         `bson:"tunnelPid"`
+	ServerPid int         `bson:"serverPid"`
+	// When the processes started, to tell them apart from others that got
+	// their pids after they exited.
+	TunnelStart uint64 `bson:"tunnelStart"`
+	ServerStart uint64 `bson:"serverStart"`
+	Address     string `bson:"address"`
+	// The channel the server was started from, and the message with its
+	// address, deleted when it stops.
+	Channel        string `bson:"channel"`
+	AddressMessage string `bson:"addressMessage"`
+	// The pinned message that shows the state of the server.
+	StatusChannel string    `bson:"statusChannel"`
+	StatusMessage string    `bson:"statusMessage"`
+	Updated       time.Time `bson:"updated"`
+}
+
+// process is a process the bot started, or one it found running when it
+// started. exited is closed when it ends.
+type process struct {
+	pid int
+	// In clock ticks since boot, as in /proc/<pid>/stat.
+	start  uint64
+	exited chan struct{}
+}
+
+// processStartTime returns when a process started, in clock ticks since boot.
+func processStartTime(pid int) (uint64, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The name of the command, in parentheses, can have spaces in it. The
+	// start time is the 22nd field, the 20th after the name.
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// startProcess starts cmd and reaps it when it exits.
+func startProcess(cmd *exec.Cmd) (*process, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{pid: cmd.Process.Pid, exited: make(chan struct{})}
+	// It can only fail if the process is already gone, and then there is
+	// nothing left to tell apart.
+	p.start, _ = processStartTime(p.pid)
+	go func() {
+		cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// processAlive tells whether the process that started at start is still
+// running with that pid. Processes without a start time are never taken as
+// ours, since the pid could belong to anything by now.
+func processAlive(pid int, start uint64) bool {
+	if pid <= 0 || start == 0 {
+		return false
+	}
+	current, err := processStartTime(pid)
+	return err == nil && current == start
+}
+
+// adoptProcess watches a process started by a previous run of the bot. It is
+// not our child, so all that can be done is polling whether it is alive.
+func adoptProcess(pid int, start uint64) *process {
+	p := &process{pid: pid, start: start, exited: make(chan struct{})}
+	go func() {
+		for processAlive(pid, start) {
+			time.Sleep(processPollPeriod)
+		}
+		close(p.exited)
+	}()
+	return p
+}
+
+func (p *process) running() bool {
+	if p == nil {
+		return false
+	}
+	select {
+	case <-p.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// signal sends signal to the process, or to its process group if group is
+// set. If the process does not lead a group, it gets the signal itself.
+func (p *process) signal(signal syscall.Signal, group bool) error {
+	if group {
+		err := syscall.Kill(-p.pid, signal)
+		if !errors.Is(err, syscall.ESRCH) {
+			return err
+		}
+	}
+	if err := syscall.Kill(p.pid, signal); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
+
+// stop sends signal to the process, or to its process group if group is set,
+// and kills it if it has not exited after timeout.
+func (p *process) stop(signal syscall.Signal, group bool, timeout time.Duration) error {
+	if !p.running() {
+		return nil
+	}
+	// An adopted process may have exited since it was last polled, and its
+	// pid been given to something else.
+	if p.start != 0 && !processAlive(p.pid, p.start) {
+		return nil
+	}
+	if err := p.signal(signal, group); err != nil {
+		return err
+	}
+	select {
+	case <-p.exited:
+		return nil
+	case <-time.After(timeout):
+	}
+	logger.Printf("Process %d did not stop in %v, killing it\n", p.pid, timeout)
+	if err := p.signal(syscall.SIGKILL, group); err != nil {
+		return err
+	}
+	select {
+	case <-p.exited:
+		return nil
+	case <-time.After(processKillTimeout):
+		return fmt.Errorf("process %d did not exit after being killed", p.pid)
+	}
+}
+
+// serverRecords is where the records of the servers are kept.
+type serverRecords interface {
+	// load returns mongo.ErrNoDocuments if the server has no record.
+	load(name string) (serverRecord, error)
+	save(record serverRecord) error
+}
+
+type mongoServerRecords struct{}
+
+func (mongoServerRecords) load(name string) (serverRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var record serverRecord
+	err := getDatabase().Collection("gameServers").FindOne(ctx, bson.M{"name": name}).Decode(&record)
+	return record, err
+}
+
+func (mongoServerRecords) save(record serverRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("gameServers").ReplaceOne(
+		ctx,
+		bson.M{"name": record.Name},
+		record,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// gameServer manages a game server and the tunnel that makes it reachable.
+// Every change of state goes through the mutex, so starting and stopping can
+// be asked for any number of times from anywhere.
+type gameServer struct {
+	mutex      sync.Mutex
+	config     serverConfig
+	stopSignal syscall.Signal
+	tunnel     tunnel
+	records    serverRecords
+	record     serverRecord
+	// The process keeping the tunnel open, if it needs one.
+	tunnelProcess *process
+	server        *process
+	// Closed to stop watching the processes of the current run.
+	done chan struct{}
+	// The output of the server goes to logFile, or through logs for the
+	// servers whose log is relayed to Discord.
+	logFile *rotatingFile
+	logs    *mcLogRelay
+	// When the last player left, for the idle shutdown.
+	emptySince time.Time
+}
+
+var (
+	hc              *gameServer
+	hcStatusChannel string
+	hcPort          = defaultMCPort
+	hcLogPath       = "hc.log"
+)
+
+// setState persists the new state of the server and shows it in the status
+// message. The mutex must be held.
+func (s *gameServer) setState(session *dgo.Session, state serverState) {
+	s.record.State = state
+	s.record.Updated = time.Now()
+	s.saveRecord()
+	s.updateStatusMessage(session)
+}
+
+// saveRecord persists the record of the server. The mutex must be held.
+func (s *gameServer) saveRecord() {
+	if err := s.records.save(s.record); err != nil {
+		logger.Printf("Could not save the state of server %s: %v\n", s.record.Name, err)
+	}
+}
+
+// release takes the processes of the current run away from the server, so
+// that they can be stopped without holding the mutex. The record keeps their
+// pids until the next state is saved. The mutex must be held.
+func (s *gameServer) release(session *dgo.Session) (*process, *process) {
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	server, tunnelProcess := s.server, s.tunnelProcess
+	s.server, s.tunnelProcess = nil, nil
+	if s.record.AddressMessage != "" {
+		session.ChannelMessageDelete(s.record.Channel, s.record.AddressMessage)
+	}
+	s.record.TunnelPid = 0
+	s.record.ServerPid = 0
+	s.record.TunnelStart = 0
+	s.record.ServerStart = 0
+	s.record.Address = ""
+	s.record.AddressMessage = ""
+	return server, tunnelProcess
+}
+
+// stopProcesses stops the server and the tunnel released from a run.
+func (s *gameServer) stopProcesses(server, tunnelProcess *process) error {
+	var errs []error
+	if server != nil {
+		errs = append(errs, server.stop(s.stopSignal, true, serverStopTimeout))
+	}
+	if tunnelProcess != nil {
+		errs = append(errs, tunnelProcess.stop(syscall.SIGTERM, false, 5*time.Second))
+	}
+	return errors.Join(errs...)
+}
+
+// cleanUp stops whatever is left of the server and its tunnel. The mutex must
+// be held.
+func (s *gameServer) cleanUp(session *dgo.Session) error {
+	return s.stopProcesses(s.release(session))
+}
+
+// watch marks the server as crashed if the server or its tunnel exit while it
+// is running.
+func (s *gameServer) watch(session *dgo.Session, done, serverExited, tunnelExited chan struct{}) {
+	var which string
+	select {
+	case <-done:
+		return
+	case <-serverExited:
+		which = "The server"
+	case <-tunnelExited:
+		which = "The tunnel"
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.done != done || s.record.State != serverRunning {
+		return
+	}
+	logger.Printf("%s of %s exited on its own\n", which, s.record.Name)
+	channel := s.record.Channel
+	if err := s.cleanUp(session); err != nil {
+		logger.Printf("Could not clean up after %s crashed: %v\n", s.record.Name, err)
+	}
+	s.setState(session, serverCrashed)
+	session.ChannelMessageSend(
+		channel,
+		fmt.Sprintf("%s stopped unexpectedly. Use `$server start %s` to start it again.", which, s.config.Name),
+	)
+}
+
+// startWatching starts watching the processes of the current run. The mutex
+// must be held.
+func (s *gameServer) startWatching(session *dgo.Session) {
+	s.done = make(chan struct{})
+	// Tunnels without a process never go down: receiving from a nil channel
+	// blocks forever.
+	var tunnelExited chan struct{}
+	if s.tunnelProcess != nil {
+		tunnelExited = s.tunnelProcess.exited
+	}
+	go s.watch(session, s.done, s.server.exited, tunnelExited)
+}
+
+func (s *gameServer) start(session *dgo.Session, channel string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch s.record.State {
+	case serverRunning:
+		_, err := session.ChannelMessageSend(channel, fmt.Sprintf("The server is already up: `%s`", s.record.Address))
+		return err
+	case serverStarting, serverStopping:
+		_, err := session.ChannelMessageSend(channel, fmt.Sprintf("The server is %s, try again in a bit.", s.record.State))
+		return err
+	}
+
+	s.record.Channel = channel
+	s.setState(session, serverStarting)
+	// Opening the tunnel can take a while. The state keeps anyone else from
+	// starting or stopping the server in the meantime.
+	s.mutex.Unlock()
+	tunnelProcess, address, err := s.tunnel.open(s.config.Port)
+	s.mutex.Lock()
+	fail := func(err error) error {
+		session.ChannelMessageSend(channel, serverStartupError)
+		if cleanUpErr := s.cleanUp(session); cleanUpErr != nil {
+			logger.Printf("Could not clean up after a failed startup: %v\n", cleanUpErr)
+		}
+		s.setState(session, serverStopped)
+		return err
+	}
+
+	if err != nil {
+		return fail(fmt.Errorf("could not open the %s tunnel: %w", s.tunnel.name(), err))
+	}
+	if tunnelProcess != nil {
+		s.tunnelProcess = tunnelProcess
+		s.record.TunnelPid = tunnelProcess.pid
+		s.record.TunnelStart = tunnelProcess.start
+	}
+
+	// Then run the server, in its own process group so that stopping it
+	// stops whatever it runs too
+	cmd := exec.Command(s.config.Command[0], s.config.Command[1:]...)
+	cmd.Dir = s.config.Dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if s.logs != nil {
+		output := s.logs.output()
+		cmd.Stdout = output
+		cmd.Stderr = output
+	} else {
+		cmd.Stdout = s.logFile
+		cmd.Stderr = s.logFile
+	}
+	server, err := startProcess(cmd)
+	if err != nil {
+		return fail(err)
+	}
+	s.server = server
+	s.record.ServerPid = server.pid
+	s.record.ServerStart = server.start
+	s.record.Address = address
+
+	if address != "" {
+		message, sendErr := session.ChannelMessageSend(channel, fmt.Sprintf("`%s`", address))
+		if sendErr == nil {
+			s.record.AddressMessage = message.ID
+		}
+		err = sendErr
+	}
+	s.setState(session, serverRunning)
+	s.startWatching(session)
+	return err
+}
+
+func (s *gameServer) stop(session *dgo.Session, channel string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.record.State == serverStopped {
+		_, err := session.ChannelMessageSend(channel, "There is no server running")
+		return err
+	}
+	if s.record.State == serverCrashed {
+		s.setState(session, serverStopped)
+		_, err := session.ChannelMessageSend(channel, "There is no server running, it had stopped unexpectedly.")
+		return err
+	}
+	if s.record.State == serverStarting || s.record.State == serverStopping {
+		_, err := session.ChannelMessageSend(channel, fmt.Sprintf("The server is %s, try again in a bit.", s.record.State))
+		return err
+	}
+
+	message, _ := session.ChannelMessageSend(channel, "Stopping the server...")
+	s.setState(session, serverStopping)
+	// The server gets up to serverStopTimeout to save and exit, so it is
+	// stopped without the mutex.
+	server, tunnelProcess := s.release(session)
+	s.mutex.Unlock()
+	err := s.stopProcesses(server, tunnelProcess)
+	s.mutex.Lock()
+	if err != nil {
+		session.ChannelMessageSend(channel, serverStopError)
+		s.setState(session, serverCrashed)
+		return err
+	}
+	s.setState(session, serverStopped)
+	if message != nil {
+		session.ChannelMessageEdit(message.ChannelID, message.ID, "Server stopped.")
+	}
+	return nil
+}
+
+// reconcile loads the state the server was left in by the last run of the bot
+// and makes it match the processes that are actually running.
+func (s *gameServer) reconcile(session *dgo.Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record, err := s.records.load(s.record.Name)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.record = record
+
+	switch s.record.State {
+	case serverStopped, serverCrashed:
+		return nil
+	case serverRunning:
+		serverAlive := processAlive(s.record.ServerPid, s.record.ServerStart)
+		tunnelAlive := s.record.TunnelPid == 0 || processAlive(s.record.TunnelPid, s.record.TunnelStart)
+		if serverAlive && tunnelAlive {
+			logger.Printf("Server %s is still running, adopting it\n", s.record.Name)
+			s.server = adoptProcess(s.record.ServerPid, s.record.ServerStart)
+			if s.record.TunnelPid != 0 {
+				s.tunnelProcess = adoptProcess(s.record.TunnelPid, s.record.TunnelStart)
+			}
+			s.startWatching(session)
+			return nil
+		}
+	}
+
+	// The bot died while starting or stopping the server, or the server died
+	// while the bot was down. Whatever is left is stopped.
+	logger.Printf("Server %s was left %s, cleaning up\n", s.record.Name, s.record.State)
+	if processAlive(s.record.ServerPid, s.record.ServerStart) {
+		s.server = adoptProcess(s.record.ServerPid, s.record.ServerStart)
+	}
+	if processAlive(s.record.TunnelPid, s.record.TunnelStart) {
+		s.tunnelProcess = adoptProcess(s.record.TunnelPid, s.record.TunnelStart)
+	}
+	state := serverStopped
+	if s.record.State == serverRunning {
+		state = serverCrashed
+		session.ChannelMessageSend(
+			s.record.Channel,
+			fmt.Sprintf("The server stopped while I was away. Use `$server start %s` to start it again.", s.config.Name),
+		)
+	}
+	err = s.cleanUp(session)
+	s.setState(session, state)
+	return err
+}
+
+var serverStateIcons = map[serverState]string{
+	serverStopped:  "⚫",
+	serverStarting: "🟡",
+	serverRunning:  "🟢",
+	serverStopping: "🟠",
+	serverCrashed:  "🔴",
+}
+
+// serverHealth is the answer of a running server to its health check.
+type serverHealth struct {
+	latency time.Duration
+	// Only for the Minecraft health check.
+	minecraft *mcStatus
+}
+
+// statusDescription describes the server, with the answer to its health check
+// if it answered.
+func (s *gameServer) statusDescription(health *serverHealth) string {
+	description := fmt.Sprintf("%s The server is %s.", serverStateIcons[s.record.State], s.record.State)
+	if s.record.Address != "" {
+		description += fmt.Sprintf("\nAddress: `%s`", s.record.Address)
+	}
+	if health == nil {
+		if s.record.State == serverRunning && s.config.HealthCheck != healthCheckNone {
+			description += "\nIt is not answering yet."
+		}
+		return description
+	}
+	if status := health.minecraft; status != nil {
+		if motd := status.motd(); motd != "" {
+			description += "\n> " + strings.ReplaceAll(motd, "\n", "\n> ")
+		}
+		description += fmt.Sprintf("\nVersion: %s", status.Version.Name)
+		description += fmt.Sprintf("\nPlayers: %d/%d", status.Players.Online, status.Players.Max)
+		if len(status.Players.Sample) > 0 {
+			names := make([]string, len(status.Players.Sample))
+			for i, player := range status.Players.Sample {
+				names[i] = player.Name
+			}
+			description += " (" + strings.Join(names, ", ") + ")"
+		}
+	}
+	if health.latency > 0 {
+		description += fmt.Sprintf("\nLatency: %d ms", health.latency.Milliseconds())
+	}
+	return description
+}
+
+// ping runs the health check of the server if it should be up.
+func (s *gameServer) ping() *serverHealth {
+	if s.record.State != serverRunning {
+		return nil
+	}
+	switch s.config.HealthCheck {
+	case healthCheckMinecraft:
+		status, err := pingMCServer("localhost", s.config.Port)
+		if err != nil {
+			logger.Printf("Could not ping server %s: %v\n", s.record.Name, err)
+			return nil
+		}
+		return &serverHealth{latency: status.Latency, minecraft: status}
+	case healthCheckTCP:
+		start := time.Now()
+		connection, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(s.config.Port)), mcPingTimeout)
+		if err != nil {
+			logger.Printf("Could not connect to server %s: %v\n", s.record.Name, err)
+			return nil
+		}
+		connection.Close()
+		return &serverHealth{latency: time.Since(start)}
+	}
+	return nil
+}
+
+// updateStatusMessage edits the pinned status message, or sends and pins a
+// new one if there is none. It goes to the status channel of the server, or
+// to the channel it was last started from. The mutex must be held.
+func (s *gameServer) updateStatusMessage(session *dgo.Session) {
+	channel := s.config.StatusChannel
+	if channel == "" {
+		channel = s.record.Channel
+	}
+	if channel == "" {
+		return
+	}
+	content := fmt.Sprintf(
+		"**%s status**\n%s\nUpdated <t:%d:R>",
+		s.config.Name,
+		s.statusDescription(s.ping()),
+		s.record.Updated.Unix(),
+	)
+	if s.record.StatusChannel == channel && s.record.StatusMessage != "" {
+		if _, err := session.ChannelMessageEdit(channel, s.record.StatusMessage, content); err == nil {
+			return
+		}
+	}
+	if s.record.StatusMessage != "" {
+		session.ChannelMessageUnpin(s.record.StatusChannel, s.record.StatusMessage)
+	}
+	message, err := session.ChannelMessageSend(channel, content)
+	if err != nil {
+		logger.Printf("Could not send the status of server %s: %v\n", s.record.Name, err)
+		return
+	}
+	if err = session.ChannelMessagePin(channel, message.ID); err != nil {
+		logger.Printf("Could not pin the status of server %s: %v\n", s.record.Name, err)
+	}
+	s.record.StatusChannel = channel
+	s.record.StatusMessage = message.ID
+	s.saveRecord()
+}
+
+func (s *gameServer) sendStatus(session *dgo.Session, channel string) error {
+	s.mutex.Lock()
+	description := s.statusDescription(s.ping())
+	s.mutex.Unlock()
+	_, err := session.ChannelMessageSend(channel, description)
+	return err
+}
+
+// refreshStatus updates the players and latency in the status message while
+// the server is running.
+func (s *gameServer) refreshStatus(session *dgo.Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.record.State == serverRunning {
+		s.updateStatusMessage(session)
+	}
+	return nil
+}
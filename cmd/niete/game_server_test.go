@@ -0,0 +1,236 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryServerRecords keeps the records in memory, along with every state they
+// went through.
+type memoryServerRecords struct {
+	mutex   sync.Mutex
+	records map[string]serverRecord
+	states  []serverState
+}
+
+func (m *memoryServerRecords) load(name string) (serverRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record, ok := m.records[name]
+	if !ok {
+		return record, mongo.ErrNoDocuments
+	}
+	return record, nil
+}
+
+func (m *memoryServerRecords) save(record serverRecord) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.records == nil {
+		m.records = make(map[string]serverRecord)
+	}
+	if len(m.states) == 0 || m.states[len(m.states)-1] != record.State {
+		m.states = append(m.states, record.State)
+	}
+	m.records[record.Name] = record
+	return nil
+}
+
+func (m *memoryServerRecords) history() []serverState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return slices.Clone(m.states)
+}
+
+// fakeDiscord answers every request to the Discord API with an empty message.
+type fakeDiscord struct{}
+
+func (fakeDiscord) RoundTrip(request *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"id": "1", "channel_id": "1"}`)),
+		Request:    request,
+	}, nil
+}
+
+func newTestServer(t *testing.T) (*gameServer, *memoryServerRecords, *dgo.Session) {
+	t.Helper()
+	server, err := newGameServer(serverConfig{
+		Name:        "test",
+		Command:     []string{"sleep", "60"},
+		StopSignal:  "SIGTERM",
+		Port:        25565,
+		HealthCheck: healthCheckNone,
+		Tunnel:      "fake",
+		Log:         filepath.Join(t.TempDir(), "test.log"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := &memoryServerRecords{}
+	server.records = records
+	session, err := dgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Client = &http.Client{Transport: fakeDiscord{}}
+	t.Cleanup(func() {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		server.cleanUp(session)
+	})
+	return server, records, session
+}
+
+func stateOf(server *gameServer) serverState {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.record.State
+}
+
+func TestGameServerStartStop(t *testing.T) {
+	server, records, session := newTestServer(t)
+	if err := server.start(session, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	if stateOf(server) != serverRunning {
+		t.Fatalf("state is %s after starting", stateOf(server))
+	}
+	if server.record.Address != "fake.tunnel:25565" {
+		t.Errorf("address is %q", server.record.Address)
+	}
+	serverProcess, tunnelProcess := server.server, server.tunnelProcess
+	if !serverProcess.running() || !tunnelProcess.running() {
+		t.Fatal("the server or its tunnel are not running")
+	}
+
+	if err := server.stop(session, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	if serverProcess.running() || tunnelProcess.running() {
+		t.Error("the server or its tunnel are still running")
+	}
+	want := []serverState{serverStarting, serverRunning, serverStopping, serverStopped}
+	if got := records.history(); !slices.Equal(got, want) {
+		t.Errorf("went through %v, want %v", got, want)
+	}
+}
+
+func TestGameServerTunnelCrash(t *testing.T) {
+	server, records, session := newTestServer(t)
+	if err := server.start(session, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	serverProcess := server.server
+	if err := syscall.Kill(server.tunnelProcess.pid, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stateOf(server) != serverCrashed {
+		if time.Now().After(deadline) {
+			t.Fatalf("state is %s after the tunnel died", stateOf(server))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if serverProcess.running() {
+		t.Error("the server is still running without its tunnel")
+	}
+	want := []serverState{serverStarting, serverRunning, serverCrashed}
+	if got := records.history(); !slices.Equal(got, want) {
+		t.Errorf("went through %v, want %v", got, want)
+	}
+}
+
+// slowTunnel is a fake tunnel that takes until release is closed to open.
+type slowTunnel struct {
+	fakeTunnel
+	opening, release chan struct{}
+}
+
+func (t *slowTunnel) open(port int) (*process, string, error) {
+	close(t.opening)
+	<-t.release
+	return t.fakeTunnel.open(port)
+}
+
+func TestGameServerBusy(t *testing.T) {
+	server, records, session := newTestServer(t)
+	tunnel := &slowTunnel{opening: make(chan struct{}), release: make(chan struct{})}
+	server.tunnel = tunnel
+	started := make(chan error)
+	go func() { started <- server.start(session, "channel") }()
+	<-tunnel.opening
+
+	// The server can be asked about while the tunnel opens, but not started
+	// or stopped again.
+	if err := server.sendStatus(session, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.start(session, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.stop(session, "channel"); err != nil {
+		t.Fatal(err)
+	}
+	if stateOf(server) != serverStarting {
+		t.Errorf("state is %s while opening the tunnel", stateOf(server))
+	}
+	close(tunnel.release)
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+	want := []serverState{serverStarting, serverRunning}
+	if got := records.history(); !slices.Equal(got, want) {
+		t.Errorf("went through %v, want %v", got, want)
+	}
+}
+
+func TestProcessAlive(t *testing.T) {
+	p, err := startProcess(exec.Command("sleep", "60"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.start == 0 {
+		t.Fatal("the process has no start time")
+	}
+	if start, err := processStartTime(os.Getpid()); err != nil || start == 0 {
+		t.Errorf("the start time of the test is %d, %v", start, err)
+	}
+	if !processAlive(p.pid, p.start) {
+		t.Error("the process is not alive")
+	}
+	// The same pid started at another time is another process.
+	if processAlive(p.pid, p.start+1) || processAlive(p.pid, 0) {
+		t.Error("a process with another start time is alive")
+	}
+
+	adopted := adoptProcess(p.pid, p.start)
+	if !adopted.running() {
+		t.Error("the adopted process is not running")
+	}
+	if err = p.stop(syscall.SIGTERM, false, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if p.running() || processAlive(p.pid, p.start) {
+		t.Error("the process is still alive")
+	}
+	// Stopping the adopted process too does not signal whatever has its pid
+	// now.
+	if err = adopted.stop(syscall.SIGTERM, false, time.Second); err != nil {
+		t.Error(err)
+	}
+}
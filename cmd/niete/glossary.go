@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type glossaryEntry struct {
+	Source string `bson:"source"`
+	Target string `bson:"target"`
+}
+
+// glossary holds how a server wants names and terms translated, e.g. ニーテ as
+// Niete instead of whatever the translator comes up with.
+type glossary struct {
+	GuildId string          `bson:"guildId"`
+	Entries []glossaryEntry `bson:"entries"`
+}
+
+func getGlossary(guild string) (*glossary, error) {
+	terms := &glossary{GuildId: guild}
+	if guild == "" {
+		return terms, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := getDatabase().Collection("glossary").FindOne(ctx, bson.M{"guildId": guild}).Decode(terms)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return terms, nil
+}
+
+func saveGlossary(terms *glossary) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("glossary").ReplaceOne(
+		ctx,
+		bson.M{"guildId": terms.GuildId},
+		terms,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// hash identifies the contents of the glossary, so that translations made
+// with another version of it are not taken from the cache. It is empty for an
+// empty glossary.
+func (g *glossary) hash() string {
+	if g == nil || len(g.Entries) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, entry := range g.Entries {
+		fmt.Fprintf(hash, "%s\x00%s\x00", entry.Source, entry.Target)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// glossaryPlaceholderRegex matches the placeholders the terms are swapped for
+// while translating, also after the translator has changed their case or
+// spacing.
+var glossaryPlaceholderRegex = regexp.MustCompile(`(?i)\[\s*g\s*(\d+)\s*\]`)
+
+// protect swaps the terms of the glossary for numbered placeholders that the
+// translators leave alone, and returns the translation of every placeholder.
+// Longer terms go first so that a term inside another one does not break it.
+func (g *glossary) protect(text string) (string, []string) {
+	if g == nil || len(g.Entries) == 0 {
+		return text, nil
+	}
+	entries := slices.Clone(g.Entries)
+	slices.SortStableFunc(entries, func(a, b glossaryEntry) int {
+		return utf8.RuneCountInString(b.Source) - utf8.RuneCountInString(a.Source)
+	})
+	pairs := make([]string, 0, 2*len(entries))
+	targets := make([]string, len(entries))
+	for i, entry := range entries {
+		pairs = append(pairs, entry.Source, fmt.Sprintf("[G%d]", i))
+		targets[i] = entry.Target
+	}
+	return strings.NewReplacer(pairs...).Replace(text), targets
+}
+
+// restore puts the translations of the terms back in place of the
+// placeholders. It returns false if the translator dropped or mangled any of
+// the placeholders in protected.
+func restore(translated, protected string, targets []string) (string, bool) {
+	expected := make(map[string]bool)
+	for _, match := range glossaryPlaceholderRegex.FindAllStringSubmatch(protected, -1) {
+		expected[match[1]] = true
+	}
+	found := make(map[string]bool)
+	restored := glossaryPlaceholderRegex.ReplaceAllStringFunc(translated, func(placeholder string) string {
+		n := glossaryPlaceholderRegex.FindStringSubmatch(placeholder)[1]
+		index, err := strconv.Atoi(n)
+		if err != nil || index >= len(targets) {
+			return placeholder
+		}
+		found[n] = true
+		return targets[index]
+	})
+	for n := range expected {
+		if !found[n] {
+			return restored, false
+		}
+	}
+	return restored, true
+}
+
+// translateWithGlossary translates text with the glossary applied. The
+// glossary translates into English, so it is ignored for other languages.
+func translateWithGlossary(text string, terms *glossary, opts translationOptions) (*translation, error) {
+	protected, targets := text, []string(nil)
+	if sameLanguage(opts.TargetLanguage, "EN") {
+		protected, targets = terms.protect(text)
+	}
+	result, err := translators.translate(protected, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Text = html.UnescapeString(result.Text)
+	if protected == text {
+		return result, nil
+	}
+	restored, ok := restore(result.Text, protected, targets)
+	if !ok {
+		logger.Printf("%s lost the glossary terms of %q, translating without them\n", result.Translator, text)
+		if result, err = translators.translate(text, opts); err != nil {
+			return nil, err
+		}
+		restored = html.UnescapeString(result.Text)
+	}
+	result.Text = restored
+	return result, nil
+}
+
+func sendGlossary(session *dgo.Session, channel string, terms *glossary) error {
+	if len(terms.Entries) == 0 {
+		_, err := session.ChannelMessageSend(channel, "The glossary is empty. Use `$glossary add <jp> <en>`.")
+		return err
+	}
+	table := newTextTable(tableColumn{Header: "Term", MaxWidth: 24}, tableColumn{Header: "Translation", MaxWidth: 32})
+	for _, entry := range terms.Entries {
+		table.addRow(entry.Source, entry.Target)
+	}
+	return sendTable(session, channel, "Glossary", "", "", table)
+}
+
+func sendGlossaryPreview(session *dgo.Session, channel string, terms *glossary, text string) error {
+	opts := translationOptions{TargetLanguage: "EN", Formality: "prefer_less"}
+	raw, err := translators.translate(text, opts)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	withGlossary, err := translateWithGlossary(text, terms, opts)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	embed := &dgo.MessageEmbed{
+		Title:       "Glossary preview",
+		Description: truncateText(text, embedDescriptionLimit),
+		Fields: []*dgo.MessageEmbedField{
+			{Name: "Without the glossary", Value: truncateText(html.UnescapeString(raw.Text), embedFieldLimit), Inline: true},
+			{Name: "With the glossary", Value: truncateText(withGlossary.Text, embedFieldLimit), Inline: true},
+		},
+		Footer: &dgo.MessageEmbedFooter{Text: fmt.Sprintf("Translated from %s by %s", raw.SourceLanguage, raw.Translator)},
+	}
+	_, err = session.ChannelMessageSendEmbed(channel, embed)
+	return err
+}
+
+func glossaryHandler(session *dgo.Session, channel, guild, userId string, args []string) error {
+	if guild == "" {
+		_, err := session.ChannelMessageSend(channel, "The glossary can only be used in a server.")
+		return err
+	}
+	terms, err := getGlossary(guild)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		return sendGlossary(session, channel, terms)
+	}
+	if args[0] == "preview" && len(args) > 1 {
+		return sendGlossaryPreview(session, channel, terms, strings.Join(args[1:], " "))
+	}
+	if !isAdmin(session, channel, userId) {
+		_, err = session.ChannelMessageSend(channel, "Only admins can change the glossary.")
+		return err
+	}
+
+	var reply string
+	switch {
+	case args[0] == "add" && len(args) > 2:
+		source, target := args[1], strings.Join(args[2:], " ")
+		terms.Entries = slices.DeleteFunc(terms.Entries, func(entry glossaryEntry) bool { return entry.Source == source })
+		terms.Entries = append(terms.Entries, glossaryEntry{Source: source, Target: target})
+		reply = fmt.Sprintf("%s will be translated as %s.", source, target)
+	case args[0] == "remove" && len(args) == 2:
+		before := len(terms.Entries)
+		terms.Entries = slices.DeleteFunc(terms.Entries, func(entry glossaryEntry) bool { return entry.Source == args[1] })
+		if len(terms.Entries) == before {
+			_, err = session.ChannelMessageSend(channel, "That term is not in the glossary.")
+			return err
+		}
+		reply = fmt.Sprintf("Removed %s from the glossary.", args[1])
+	default:
+		_, err = session.ChannelMessageSend(
+			channel,
+			"Usage: `$glossary [list|add <jp> <en>|remove <jp>|preview <text>]`",
+		)
+		return err
+	}
+
+	if err = saveGlossary(terms); err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = session.ChannelMessageSend(channel, reply)
+	return err
+}
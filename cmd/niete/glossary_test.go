@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Jrryy/Niete/internal/faketranslator"
+)
+
+var testGlossary = &glossary{Entries: []glossaryEntry{
+	{Source: "古戦場", Target: "Unite and Fight"},
+	{Source: "ニーテ", Target: "Niete"},
+	{Source: "ニーテちゃん", Target: "Niete-chan"},
+}}
+
+func TestGlossaryRestore(t *testing.T) {
+	protected, targets := testGlossary.protect("ニーテちゃんとニーテは古戦場")
+	if protected != "[G0]と[G2]は[G1]" {
+		t.Fatalf("protected the text as %q", protected)
+	}
+	tests := []struct {
+		name       string
+		translated string
+		want       string
+		wantOk     bool
+	}{
+		{
+			name:       "unchanged placeholders",
+			translated: "[G0] and [G2] in [G1]",
+			want:       "Niete-chan and Niete in Unite and Fight",
+			wantOk:     true,
+		},
+		{
+			name:       "altered placeholders",
+			translated: "[g0] and [ G2 ] in [G 1]",
+			want:       "Niete-chan and Niete in Unite and Fight",
+			wantOk:     true,
+		},
+		{name: "dropped placeholder", translated: "[G0] and [G2]", want: "Niete-chan and Niete"},
+		{name: "unknown placeholder", translated: "[G0] and [G2] in [G7]", want: "Niete-chan and Niete in [G7]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := restore(test.translated, protected, targets)
+			if got != test.want || ok != test.wantOk {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestTranslateWithGlossary(t *testing.T) {
+	deepl, _, _ := newFakeTranslators(t, &faketranslator.Options{})
+	previous := translators
+	translators = deepl
+	t.Cleanup(func() { translators = previous })
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "EN", want: "[EN] Niete-chanとNieteはUnite and Fight"},
+		{target: "EN-GB", want: "[EN-GB] Niete-chanとNieteはUnite and Fight"},
+		// The glossary only has English translations.
+		{target: "DE", want: "[DE] ニーテちゃんとニーテは古戦場"},
+	}
+	for _, test := range tests {
+		result, err := translateWithGlossary("ニーテちゃんとニーテは古戦場", testGlossary, translationOptions{TargetLanguage: test.target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Text != test.want {
+			t.Errorf("translated into %s as %q, want %q", test.target, result.Text, test.want)
+		}
+	}
+}
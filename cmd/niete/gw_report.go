@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GW days roll over at midnight in Japan, which has no daylight saving time.
+var jst = time.FixedZone("JST", 9*60*60)
+
+// A snapshot taken this close to the start of a day counts as taken at its
+// start.
+const snapshotTolerance = time.Hour
+
+// The start of the last day each crew has a snapshot of. Only used by
+// takeDailySnapshots.
+var dailySnapshots = make(map[string]time.Time)
+
+type memberSnapshotEntry struct {
+	UserId     uint64 `bson:"userId"`
+	Name       string `bson:"name"`
+	HasRanking bool   `bson:"hasRanking"`
+	Points     uint64 `bson:"points"`
+}
+
+type memberSnapshot struct {
+	CrewId  string                `bson:"crewId"`
+	Taken   time.Time             `bson:"taken"`
+	Members []memberSnapshotEntry `bson:"members"`
+}
+
+type honorQuota struct {
+	CrewId string `bson:"crewId"`
+	Period string `bson:"period"`
+	Honors uint64 `bson:"honors"`
+}
+
+type memberContribution struct {
+	UserId uint64
+	Name   string
+	Honors uint64
+}
+
+func memberPoints(member userRankingData) uint64 {
+	if !member.HasRanking || member.Ranking == nil {
+		return 0
+	}
+	return member.Ranking.Point
+}
+
+// parseHonors accepts plain numbers, numbers with thousands separators and
+// k/m/b suffixes, e.g. "12,000,000", "12m" or "1.5b".
+func parseHonors(value string) (uint64, error) {
+	value = strings.ToLower(strings.ReplaceAll(value, ",", ""))
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1e3
+	case strings.HasSuffix(value, "m"):
+		multiplier = 1e6
+	case strings.HasSuffix(value, "b"):
+		multiplier = 1e9
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	// ParseFloat also takes inf and nan, which do not fit in a uint64.
+	if err != nil || number < 0 || math.IsNaN(number) || number*multiplier >= math.MaxUint64 {
+		return 0, fmt.Errorf("invalid amount of honors: %q", value)
+	}
+	return uint64(number * multiplier), nil
+}
+
+func startOfDayJST(t time.Time) time.Time {
+	t = t.In(jst)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, jst)
+}
+
+// readMemberSnapshot reads the honors of the members of the crew without
+// storing them, using data cached for up to ttl.
+func readMemberSnapshot(crewId string, ttl time.Duration) (*memberSnapshot, error) {
+	members, err := fetchCrewGWMembers(crewId, ttl)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &memberSnapshot{CrewId: crewId, Taken: time.Now()}
+	for _, member := range members {
+		snapshot.Members = append(snapshot.Members, memberSnapshotEntry{
+			UserId:     member.UserId,
+			Name:       member.Name,
+			HasRanking: member.HasRanking,
+			Points:     memberPoints(member),
+		})
+	}
+	return snapshot, nil
+}
+
+func saveMemberSnapshot(snapshot *memberSnapshot) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("memberSnapshots").InsertOne(ctx, snapshot)
+	return err
+}
+
+// takeMemberSnapshot stores the current honors of the members of the crew.
+// They are never taken from the cache, which could hold the honors of
+// several minutes ago.
+func takeMemberSnapshot(crewId string) (*memberSnapshot, error) {
+	snapshot, err := readMemberSnapshot(crewId, 0)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, saveMemberSnapshot(snapshot)
+}
+
+// findSnapshotNear returns the snapshot of the crew taken closest to t,
+// before or after it.
+func findSnapshotNear(crewId string, t time.Time) (*memberSnapshot, error) {
+	collection := getDatabase().Collection("memberSnapshots")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var candidates []*memberSnapshot
+	for _, query := range []struct {
+		op   string
+		sort int
+	}{{"$lte", -1}, {"$gt", 1}} {
+		snapshot := &memberSnapshot{}
+		err := collection.FindOne(
+			ctx,
+			bson.M{"crewId": crewId, "taken": bson.M{query.op: t}},
+			options.FindOne().SetSort(bson.M{"taken": query.sort}),
+		).Decode(snapshot)
+		if err == nil {
+			candidates = append(candidates, snapshot)
+		} else if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	closest := candidates[0]
+	for _, snapshot := range candidates[1:] {
+		if snapshot.Taken.Sub(t).Abs() < closest.Taken.Sub(t).Abs() {
+			closest = snapshot
+		}
+	}
+	return closest, nil
+}
+
+// snapshotNear tells whether a snapshot counts as taken at t.
+func snapshotNear(snapshot *memberSnapshot, t time.Time) bool {
+	return snapshot.Taken.Sub(t).Abs() <= snapshotTolerance
+}
+
+// takeDailySnapshots takes a snapshot of every configured crew at the start of
+// each day in Japan, so that the daily reports have something to compare
+// against.
+func takeDailySnapshots() error {
+	dayStart := startOfDayJST(time.Now())
+	if time.Since(dayStart) > snapshotTolerance {
+		return nil
+	}
+	crews, err := allConfiguredCrews()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, crewId := range crews {
+		if dailySnapshots[crewId].Equal(dayStart) {
+			continue
+		}
+		// The bot may have been restarted after taking it.
+		snapshot, err := findSnapshotNear(crewId, dayStart)
+		if err != nil && err != mongo.ErrNoDocuments {
+			errs = append(errs, err)
+			continue
+		}
+		if snapshot == nil || snapshot.Taken.Before(dayStart) {
+			if _, err = takeMemberSnapshot(crewId); err != nil {
+				errs = append(errs, fmt.Errorf("crew %s: %w", crewId, err))
+				continue
+			}
+		}
+		dailySnapshots[crewId] = dayStart
+	}
+	return errors.Join(errs...)
+}
+
+func getHonorQuotas(crewId string) (map[string]uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := getDatabase().Collection("honorQuotas").Find(ctx, bson.M{"crewId": crewId})
+	if err != nil {
+		return nil, err
+	}
+	var quotas []honorQuota
+	if err = cursor.All(ctx, &quotas); err != nil {
+		return nil, err
+	}
+	result := make(map[string]uint64)
+	for _, quota := range quotas {
+		result[quota.Period] = quota.Honors
+	}
+	return result, nil
+}
+
+func setHonorQuota(session *dgo.Session, channel, crewId string, args []string) error {
+	if len(args) == 0 {
+		quotas, err := getHonorQuotas(crewId)
+		if err != nil {
+			return err
+		}
+		message := "Quotas:\n"
+		for _, period := range []string{"day", "round"} {
+			quota, ok := quotas[period]
+			if !ok {
+				message += fmt.Sprintf("- Per %s: not set\n", period)
+			} else {
+				message += fmt.Sprintf("- Per %s: %s honors\n", period, intComma(int(quota)))
+			}
+		}
+		_, err = session.ChannelMessageSend(channel, message)
+		return err
+	}
+	if len(args) < 2 || (args[0] != "day" && args[0] != "round") {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$gw quota [day|round] <honors|off>`")
+		return err
+	}
+	collection := getDatabase().Collection("honorQuotas")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{"crewId": crewId, "period": args[0]}
+	if args[1] == "off" {
+		_, err := collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return err
+		}
+		_, err = session.ChannelMessageSend(channel, fmt.Sprintf("Removed the quota per %s.", args[0]))
+		return err
+	}
+	honors, err := parseHonors(args[1])
+	if err != nil {
+		_, err = session.ChannelMessageSend(channel, "Please input a valid amount of honors.")
+		return err
+	}
+	_, err = collection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"honors": honors}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = session.ChannelMessageSend(
+		channel,
+		fmt.Sprintf("The quota per %s is now %s honors.", args[0], intComma(int(honors))),
+	)
+	return err
+}
+
+// snapshotContributions returns the honors each member earned between two
+// snapshots, from the most to the least. Without a baseline, those are their
+// totals in the current GW.
+func snapshotContributions(baseline, current *memberSnapshot) []memberContribution {
+	baselinePoints := make(map[uint64]uint64)
+	if baseline != nil {
+		for _, member := range baseline.Members {
+			baselinePoints[member.UserId] = member.Points
+		}
+	}
+	contributions := make([]memberContribution, 0, len(current.Members))
+	for _, member := range current.Members {
+		honors := member.Points
+		if before := baselinePoints[member.UserId]; before <= honors {
+			honors -= before
+		}
+		contributions = append(contributions, memberContribution{
+			UserId: member.UserId,
+			Name:   member.Name,
+			Honors: honors,
+		})
+	}
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return contributions[i].Honors > contributions[j].Honors
+	})
+	return contributions
+}
+
+// getContributions returns the honors each member earned in the given period.
+// Per round, that is the member's total in the current GW. Per day, it is the
+// difference with the snapshot taken closest to dayStart.
+func getContributions(crewId, period string, dayStart time.Time) ([]memberContribution, string, error) {
+	var baseline *memberSnapshot
+	var err error
+	if period == "day" {
+		baseline, err = findSnapshotNear(crewId, dayStart)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, "", err
+		}
+	}
+	// Reports are only stored when there is nothing to compare them with, so
+	// that asking for them often does not fill the database.
+	current, err := readMemberSnapshot(crewId, 2*time.Minute)
+	if err != nil {
+		return nil, "", err
+	}
+	note := "Honors earned in the current GW."
+	if period == "day" {
+		switch {
+		case baseline == nil:
+			if err = saveMemberSnapshot(current); err != nil {
+				return nil, "", err
+			}
+			baseline = current
+			note = "No earlier snapshot. Honors are counted from now on."
+		case !snapshotNear(baseline, dayStart):
+			note = fmt.Sprintf("No snapshot of the start of the day. Honors earned since %s JST.", baseline.Taken.In(jst).Format("Jan 2 15:04"))
+		default:
+			note = "Honors earned since " + dayStart.In(jst).Format("Jan 2 15:04") + " JST."
+		}
+	}
+	return snapshotContributions(baseline, current), note, nil
+}
+
+func contributionsCSV(contributions []memberContribution, quota uint64) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := csv.NewWriter(buffer)
+	err := writer.Write([]string{"user_id", "name", "honors", "quota", "met_quota", "shortfall"})
+	if err != nil {
+		return nil, err
+	}
+	for _, contribution := range contributions {
+		var shortfall uint64
+		if contribution.Honors < quota {
+			shortfall = quota - contribution.Honors
+		}
+		err = writer.Write([]string{
+			strconv.FormatUint(contribution.UserId, 10),
+			contribution.Name,
+			strconv.FormatUint(contribution.Honors, 10),
+			strconv.FormatUint(quota, 10),
+			strconv.FormatBool(shortfall == 0),
+			strconv.FormatUint(shortfall, 10),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+func sendGWReport(session *dgo.Session, channel, crewId string, args []string) error {
+	if crewId == "" {
+		_, err := session.ChannelMessageSend(channel, "There is no crew configured. Use `$crew set <crew id>`.")
+		return err
+	}
+	period := "day"
+	exportCSV := false
+	for _, arg := range args {
+		switch arg {
+		case "day", "round":
+			period = arg
+		case "csv":
+			exportCSV = true
+		}
+	}
+	quotas, err := getHonorQuotas(crewId)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	quota := quotas[period]
+	contributions, note, err := getContributions(crewId, period, startOfDayJST(time.Now()))
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong when retrieving the data.")
+		return err
+	}
+
+	if exportCSV {
+		data, err := contributionsCSV(contributions, quota)
+		if err != nil {
+			return err
+		}
+		filename := fmt.Sprintf("gw_report_%s_%s_%s.csv", crewId, period, time.Now().In(jst).Format("20060102_1504"))
+		_, err = session.ChannelFileSend(channel, filename, bytes.NewReader(data))
+		return err
+	}
+
+	var total uint64
+	met := 0
+	table := newTextTable(
+		tableColumn{Header: "#", AlignRight: true},
+		tableColumn{Header: "Player", MaxWidth: 15},
+		tableColumn{Header: "Honors", AlignRight: true},
+		tableColumn{Header: "Quota", AlignRight: true},
+	)
+	for n, contribution := range contributions {
+		total += contribution.Honors
+		status := "-"
+		switch {
+		case quota == 0:
+		case contribution.Honors >= quota:
+			met++
+			status = "OK"
+		default:
+			status = "-" + intComma(int(quota-contribution.Honors))
+		}
+		table.addRow(fmt.Sprint(n+1), contribution.Name, intComma(int(contribution.Honors)), status)
+	}
+	footer := note + "\n"
+	if quota > 0 {
+		footer += fmt.Sprintf(
+			"Quota per %s: %s honors. %d/%d members met it.\n",
+			period, intComma(int(quota)), met, len(contributions),
+		)
+	}
+	footer += fmt.Sprintf("Crew total: %s honors.", intComma(int(total)))
+	if quota > 0 {
+		mentions, err := shortfallMentions(contributions, quota)
+		if err != nil {
+			logger.Printf("Could not get the linked accounts for the GW report: %v\n", err)
+		} else if mentions != "" {
+			footer += "\n" + mentions
+		}
+	}
+
+	return sendTable(session, channel, "GW report", "", footer, table)
+}
+
+func sendMemberSnapshot(session *dgo.Session, channel, crewId string) error {
+	if crewId == "" {
+		_, err := session.ChannelMessageSend(channel, "There is no crew configured. Use `$crew set <crew id>`.")
+		return err
+	}
+	snapshot, err := takeMemberSnapshot(crewId)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong when retrieving the data.")
+		return err
+	}
+	_, err = session.ChannelMessageSend(
+		channel,
+		fmt.Sprintf("Saved the honors of %d members.", len(snapshot.Members)),
+	)
+	return err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseHonors(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{value: "12000000", want: 12000000},
+		{value: "12,000,000", want: 12000000},
+		{value: "500k", want: 500000},
+		{value: "12m", want: 12000000},
+		{value: "12M", want: 12000000},
+		{value: "1.5b", want: 1500000000},
+		{value: "0", want: 0},
+		{value: "", wantErr: true},
+		{value: "m", wantErr: true},
+		{value: "-5m", wantErr: true},
+		{value: "lots", wantErr: true},
+		{value: "inf", wantErr: true},
+		{value: "nan", wantErr: true},
+		{value: "1e30", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseHonors(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseHonors(%q) = %d, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseHonors(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestStartOfDayJST(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want time.Time
+	}{
+		{
+			t:    time.Date(2026, 3, 10, 14, 59, 0, 0, time.UTC),
+			want: time.Date(2026, 3, 10, 0, 0, 0, 0, jst),
+		},
+		// Midnight in Japan is 15:00 UTC.
+		{
+			t:    time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC),
+			want: time.Date(2026, 3, 11, 0, 0, 0, 0, jst),
+		},
+	}
+	for _, test := range tests {
+		if got := startOfDayJST(test.t); !got.Equal(test.want) {
+			t.Errorf("startOfDayJST(%v) = %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+func TestSnapshotContributions(t *testing.T) {
+	snapshot := func(points ...uint64) *memberSnapshot {
+		snapshot := &memberSnapshot{}
+		for i, p := range points {
+			snapshot.Members = append(snapshot.Members, memberSnapshotEntry{
+				UserId: uint64(i + 1),
+				Name:   string(rune('A' + i)),
+				Points: p,
+			})
+		}
+		return snapshot
+	}
+	tests := []struct {
+		name     string
+		baseline *memberSnapshot
+		current  *memberSnapshot
+		want     []memberContribution
+	}{
+		{
+			name:    "no baseline",
+			current: snapshot(100, 300, 200),
+			want:    []memberContribution{{2, "B", 300}, {3, "C", 200}, {1, "A", 100}},
+		},
+		{
+			name:     "earned since the baseline",
+			baseline: snapshot(100, 300),
+			current:  snapshot(400, 350),
+			want:     []memberContribution{{1, "A", 300}, {2, "B", 50}},
+		},
+		{
+			// Somebody who joined after the baseline keeps all their honors.
+			name:     "new member",
+			baseline: snapshot(100),
+			current:  snapshot(150, 80),
+			want:     []memberContribution{{2, "B", 80}, {1, "A", 50}},
+		},
+		{
+			// Honors going down mean the GW changed, so the total counts.
+			name:     "reset honors",
+			baseline: snapshot(500),
+			current:  snapshot(20),
+			want:     []memberContribution{{1, "A", 20}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := snapshotContributions(test.baseline, test.current)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestContributionsCSV(t *testing.T) {
+	data, err := contributionsCSV([]memberContribution{{1, "A", 300}, {2, "B, the second", 50}}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "user_id,name,honors,quota,met_quota,shortfall\n" +
+		"1,A,300,100,true,0\n" +
+		"2,\"B, the second\",50,100,false,50\n"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+}
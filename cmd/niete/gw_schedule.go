@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// gbfdata takes a while to publish the results of a day after its cutoff.
+	gwSummaryDelay = 30 * time.Minute
+	// If the results are still missing after this long, stop trying.
+	gwSummaryGiveUp = 6 * time.Hour
+	finalsDays      = 4
+)
+
+var errRoundDataMissing = fmt.Errorf("the results of the round are not available yet")
+
+var roundDateLayouts = []string{"2006-01-02", "2006/01/02", "01/02", "1/2", "Jan 2", "2 Jan"}
+
+type gwDay struct {
+	Name     string    `bson:"name"`
+	Start    time.Time `bson:"start"`
+	Cutoff   time.Time `bson:"cutoff"`
+	Opponent string    `bson:"opponent"`
+	Posted   bool      `bson:"posted"`
+}
+
+type gwSchedule struct {
+	Number       int       `bson:"number"`
+	CrewId       string    `bson:"crewId"`
+	Channel      string    `bson:"channel"`
+	PrelimsStart time.Time `bson:"prelimsStart"`
+	PrelimsEnd   time.Time `bson:"prelimsEnd"`
+	Days         []gwDay   `bson:"days"`
+}
+
+type gwResult struct {
+	Number          int       `bson:"number"`
+	Day             string    `bson:"day"`
+	CrewId          string    `bson:"crewId"`
+	Opponent        string    `bson:"opponent,omitempty"`
+	Rank            int64     `bson:"rank"`
+	DailyHonors     int64     `bson:"dailyHonors"`
+	TotalHonors     int64     `bson:"totalHonors"`
+	OpponentHonors  int64     `bson:"opponentHonors,omitempty"`
+	Won             bool      `bson:"won"`
+	Draw            bool      `bson:"draw"`
+	TopContributors []string  `bson:"topContributors"`
+	Archived        time.Time `bson:"archived"`
+}
+
+// newGWSchedule builds the usual GW layout from the first day of the
+// preliminaries: prelims from 19:00 JST until the end of the next day, one
+// interlude day and then the finals days, each one ending at midnight JST.
+func newGWSchedule(number int, crewId, channel string, prelimsDate time.Time) gwSchedule {
+	firstDay := startOfDayJST(prelimsDate)
+	schedule := gwSchedule{
+		Number:       number,
+		CrewId:       crewId,
+		Channel:      channel,
+		PrelimsStart: firstDay.Add(19 * time.Hour),
+		PrelimsEnd:   firstDay.AddDate(0, 0, 2),
+	}
+	schedule.Days = append(schedule.Days, gwDay{
+		Name:   "Preliminaries",
+		Start:  schedule.PrelimsStart,
+		Cutoff: schedule.PrelimsEnd,
+	})
+	for day := 1; day <= finalsDays; day++ {
+		start := firstDay.AddDate(0, 0, day+2)
+		schedule.Days = append(schedule.Days, gwDay{
+			Name:   fmt.Sprintf("Finals day %d", day),
+			Start:  start,
+			Cutoff: start.AddDate(0, 0, 1),
+		})
+	}
+	return schedule
+}
+
+func parseRound(round []string) (rank, daily, total int64) {
+	rank, _ = strconv.ParseInt(strings.TrimSpace(round[1]), 10, 64)
+	daily, _ = strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(round[2]), ",", ""), 10, 64)
+	total, _ = strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(round[3]), ",", ""), 10, 64)
+	return
+}
+
+// findRound returns the row of the given JST date from the rounds returned by
+// getLastRoundsPerformance, or nil if it is not there yet.
+func findRound(rounds [][]string, date time.Time) []string {
+	date = date.In(jst)
+	for _, round := range rounds {
+		for _, layout := range roundDateLayouts {
+			parsed, err := time.Parse(layout, strings.TrimSpace(round[0]))
+			if err == nil && parsed.Month() == date.Month() && parsed.Day() == date.Day() {
+				return round
+			}
+		}
+	}
+	return nil
+}
+
+// roundCutoff returns when the day of a row returned by
+// getLastRoundsPerformance ended, at midnight JST. Dates without a year are
+// taken as the last such date up to now.
+func roundCutoff(round []string, now time.Time) (time.Time, bool) {
+	now = now.In(jst)
+	for _, layout := range roundDateLayouts {
+		parsed, err := time.ParseInLocation(layout, strings.TrimSpace(round[0]), jst)
+		if err != nil {
+			continue
+		}
+		if parsed.Year() == 0 {
+			parsed = parsed.AddDate(now.Year(), 0, 0)
+			if parsed.After(now) {
+				parsed = parsed.AddDate(-1, 0, 0)
+			}
+		}
+		return parsed.AddDate(0, 0, 1), true
+	}
+	return time.Time{}, false
+}
+
+func getLatestGWSchedule(crewId string) (*gwSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	schedule := &gwSchedule{}
+	err := getDatabase().Collection("gwSchedules").FindOne(
+		ctx,
+		bson.M{"crewId": crewId},
+		options.FindOne().SetSort(bson.M{"prelimsStart": -1}),
+	).Decode(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func saveGWSchedule(schedule gwSchedule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("gwSchedules").ReplaceOne(
+		ctx,
+		bson.M{"number": schedule.Number, "crewId": schedule.CrewId},
+		schedule,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func sendGWSchedule(session *dgo.Session, channel string, schedule *gwSchedule) error {
+	message := fmt.Sprintf("GW #%d, summaries are posted in <#%s>\n```\n", schedule.Number, schedule.Channel)
+	for _, day := range schedule.Days {
+		message += fmt.Sprintf(
+			"%-14s %s - %s",
+			day.Name,
+			day.Start.In(jst).Format("Jan _2 15:04"),
+			day.Cutoff.In(jst).Format("Jan _2 15:04"),
+		)
+		if day.Opponent != "" {
+			message += " vs " + day.Opponent
+		}
+		if day.Posted {
+			message += " (posted)"
+		}
+		message += "\n"
+	}
+	message += "```"
+	_, err := session.ChannelMessageSend(channel, message)
+	return err
+}
+
+func gwScheduleHandler(session *dgo.Session, channel, crewId string, args []string) error {
+	if crewId == "" {
+		_, err := session.ChannelMessageSend(channel, "There is no crew configured. Use `$crew set <crew id>`.")
+		return err
+	}
+	if len(args) == 0 {
+		schedule, err := getLatestGWSchedule(crewId)
+		if err == mongo.ErrNoDocuments {
+			_, err = session.ChannelMessageSend(channel, "There is no GW scheduled.")
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		return sendGWSchedule(session, channel, schedule)
+	}
+	if len(args) < 2 {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$gw schedule <gw number> <first prelims day, YYYY-MM-DD>`")
+		return err
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		_, err = session.ChannelMessageSend(channel, "Please input the number of the GW.")
+		return err
+	}
+	prelimsDate, err := time.ParseInLocation("2006-01-02", args[1], jst)
+	if err != nil {
+		_, err = session.ChannelMessageSend(channel, "Please input the date as YYYY-MM-DD.")
+		return err
+	}
+	schedule := newGWSchedule(number, crewId, channel, prelimsDate)
+	if err = saveGWSchedule(schedule); err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	return sendGWSchedule(session, channel, &schedule)
+}
+
+func gwOpponentHandler(session *dgo.Session, channel, crewId string, args []string) error {
+	if crewId == "" {
+		_, err := session.ChannelMessageSend(channel, "There is no crew configured. Use `$crew set <crew id>`.")
+		return err
+	}
+	if len(args) < 2 {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$gw opponent <finals day> <crew id|crew name>`")
+		return err
+	}
+	day, err := strconv.Atoi(args[0])
+	if err != nil || day < 1 || day > finalsDays {
+		_, err = session.ChannelMessageSend(channel, fmt.Sprintf("The finals day must be between 1 and %d.", finalsDays))
+		return err
+	}
+	schedule, err := getLatestGWSchedule(crewId)
+	if err == mongo.ErrNoDocuments {
+		_, err = session.ChannelMessageSend(channel, "There is no GW scheduled. Use `$gw schedule` first.")
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	opponent := strings.Join(args[1:], " ")
+	if _, err = strconv.ParseUint(opponent, 10, 64); err != nil {
+		crews, err := searchCrews(opponent)
+		if err != nil {
+			session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+			return err
+		}
+		if len(crews) == 0 {
+			_, err = session.ChannelMessageSend(channel, "Crew not found.")
+			return err
+		}
+		opponent = fmt.Sprintf("%.f", crews[0].(map[string]any)["id"].(float64))
+	}
+	schedule.Days[day].Opponent = opponent
+	if err = saveGWSchedule(*schedule); err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = session.ChannelMessageSend(
+		channel,
+		fmt.Sprintf("Our opponent in %s is crew `%s`.", schedule.Days[day].Name, opponent),
+	)
+	return err
+}
+
+// dayContributions returns the honors each member earned in a GW day, between
+// the snapshots taken at its start and at its cutoff.
+func dayContributions(schedule *gwSchedule, day gwDay) ([]memberContribution, error) {
+	end, err := findSnapshotNear(schedule.CrewId, day.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	if !snapshotNear(end, day.Cutoff) {
+		return nil, fmt.Errorf("no snapshot of the end of %s", day.Name)
+	}
+	// Honors start from zero in the preliminaries.
+	var start *memberSnapshot
+	if !day.Start.Equal(schedule.PrelimsStart) {
+		if start, err = findSnapshotNear(schedule.CrewId, day.Start); err != nil {
+			return nil, err
+		}
+		if !snapshotNear(start, day.Start) {
+			return nil, fmt.Errorf("no snapshot of the start of %s", day.Name)
+		}
+	}
+	return snapshotContributions(start, end), nil
+}
+
+func postGWDaySummary(session *dgo.Session, schedule *gwSchedule, day gwDay) error {
+	// The day ends at midnight, so its results are listed under the day before.
+	date := day.Cutoff.Add(-time.Minute)
+	ourRounds, err := getLastRoundsPerformance(schedule.CrewId)
+	if err != nil {
+		return err
+	}
+	ourRound := findRound(ourRounds, date)
+	if ourRound == nil {
+		return errRoundDataMissing
+	}
+	result := gwResult{
+		Number:   schedule.Number,
+		Day:      day.Name,
+		CrewId:   schedule.CrewId,
+		Opponent: day.Opponent,
+		Archived: time.Now(),
+	}
+	result.Rank, result.DailyHonors, result.TotalHonors = parseRound(ourRound)
+
+	embed := &dgo.MessageEmbed{
+		Title: fmt.Sprintf("GW #%d %s", schedule.Number, day.Name),
+		Fields: []*dgo.MessageEmbedField{
+			{Name: "Our honors", Value: intComma(int(result.DailyHonors)), Inline: true},
+			{Name: "Total", Value: intComma(int(result.TotalHonors)), Inline: true},
+			{Name: "Rank", Value: "#" + intComma(int(result.Rank)), Inline: true},
+		},
+	}
+	if day.Opponent != "" {
+		theirRounds, err := getLastRoundsPerformance(day.Opponent)
+		if err != nil {
+			return err
+		}
+		theirRound := findRound(theirRounds, date)
+		if theirRound == nil {
+			return errRoundDataMissing
+		}
+		_, result.OpponentHonors, _ = parseRound(theirRound)
+		result.Won = result.DailyHonors > result.OpponentHonors
+		result.Draw = result.DailyHonors == result.OpponentHonors
+		margin := result.DailyHonors - result.OpponentHonors
+		opponent := fmt.Sprintf("[crew %s](http://game.granbluefantasy.jp/#guild/detail/%s)", day.Opponent, day.Opponent)
+		switch {
+		case result.Won:
+			embed.Color = 0x2ecc71
+			embed.Description = fmt.Sprintf("**Victory** against %s by %s honors.", opponent, intComma(int(margin)))
+		case result.Draw:
+			embed.Color = 0x95a5a6
+			embed.Description = fmt.Sprintf("**Draw** against %s, with the same honors.", opponent)
+		default:
+			embed.Color = 0xe74c3c
+			embed.Description = fmt.Sprintf("**Defeat** against %s by %s honors.", opponent, intComma(int(-margin)))
+		}
+		embed.Fields = append(embed.Fields, &dgo.MessageEmbedField{
+			Name:   "Their honors",
+			Value:  intComma(int(result.OpponentHonors)),
+			Inline: true,
+		})
+	}
+
+	contributions, err := dayContributions(schedule, day)
+	if err != nil {
+		logger.Printf("Could not get the contributions for the GW summary: %v\n", err)
+	} else {
+		if len(contributions) > 5 {
+			contributions = contributions[:5]
+		}
+		userIds := make([]uint64, 0, len(contributions))
+		for _, contribution := range contributions {
+			userIds = append(userIds, contribution.UserId)
+		}
+		discordIds, err := getLinkedDiscordIds(userIds)
+		if err != nil {
+			logger.Printf("Could not get the linked accounts for the GW summary: %v\n", err)
+		}
+		topContributors := ""
+		for n, contribution := range contributions {
+			if contribution.Honors == 0 {
+				break
+			}
+			result.TopContributors = append(result.TopContributors, contribution.Name)
+			topContributors += fmt.Sprintf(
+				"%d. %s - %s\n",
+				n+1,
+				memberMention(contribution.Name, contribution.UserId, discordIds),
+				intComma(int(contribution.Honors)),
+			)
+		}
+		if topContributors != "" {
+			embed.Fields = append(embed.Fields, &dgo.MessageEmbedField{Name: "Top contributors", Value: topContributors})
+		}
+	}
+
+	if _, err = session.ChannelMessageSendEmbed(schedule.Channel, embed); err != nil {
+		return err
+	}
+	// The summary is out, so failing to archive it must not post it again.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err = getDatabase().Collection("gwResults").InsertOne(ctx, result); err != nil {
+		logger.Printf("Could not archive the results of GW #%d %s: %v\n", schedule.Number, day.Name, err)
+	}
+	return nil
+}
+
+// postGWSummaries posts the summary of every scheduled GW day whose cutoff
+// has passed and that has not been posted yet.
+func postGWSummaries(session *dgo.Session) error {
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := getDatabase().Collection("gwSchedules").Find(ctx, bson.M{
+		"days": bson.M{"$elemMatch": bson.M{
+			"posted": false,
+			"cutoff": bson.M{"$lte": now.Add(-gwSummaryDelay)},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	var schedules []gwSchedule
+	if err = cursor.All(ctx, &schedules); err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		for i, day := range schedule.Days {
+			if day.Posted || now.Before(day.Cutoff.Add(gwSummaryDelay)) {
+				continue
+			}
+			err = postGWDaySummary(session, &schedule, day)
+			if err != nil {
+				if now.Before(day.Cutoff.Add(gwSummaryGiveUp)) {
+					logger.Printf("Could not post the summary of GW #%d %s yet: %v\n", schedule.Number, day.Name, err)
+					continue
+				}
+				session.ChannelMessageSend(
+					schedule.Channel,
+					fmt.Sprintf("Could not retrieve the results of GW #%d %s.", schedule.Number, day.Name),
+				)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_, err = getDatabase().Collection("gwSchedules").UpdateOne(
+				ctx,
+				bson.M{"number": schedule.Number, "crewId": schedule.CrewId},
+				bson.M{"$set": bson.M{fmt.Sprintf("days.%d.posted", i): true}},
+			)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
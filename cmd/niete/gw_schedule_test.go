@@ -0,0 +1,87 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewGWSchedule(t *testing.T) {
+	schedule := newGWSchedule(80, "123", "channel", time.Date(2026, 3, 10, 0, 0, 0, 0, jst))
+	if !schedule.PrelimsStart.Equal(time.Date(2026, 3, 10, 19, 0, 0, 0, jst)) {
+		t.Errorf("prelims start at %v", schedule.PrelimsStart)
+	}
+	if !schedule.PrelimsEnd.Equal(time.Date(2026, 3, 12, 0, 0, 0, 0, jst)) {
+		t.Errorf("prelims end at %v", schedule.PrelimsEnd)
+	}
+	want := []gwDay{
+		{Name: "Preliminaries", Start: schedule.PrelimsStart, Cutoff: schedule.PrelimsEnd},
+		// Mar 12 is the interlude.
+		{Name: "Finals day 1", Start: time.Date(2026, 3, 13, 0, 0, 0, 0, jst), Cutoff: time.Date(2026, 3, 14, 0, 0, 0, 0, jst)},
+		{Name: "Finals day 2", Start: time.Date(2026, 3, 14, 0, 0, 0, 0, jst), Cutoff: time.Date(2026, 3, 15, 0, 0, 0, 0, jst)},
+		{Name: "Finals day 3", Start: time.Date(2026, 3, 15, 0, 0, 0, 0, jst), Cutoff: time.Date(2026, 3, 16, 0, 0, 0, 0, jst)},
+		{Name: "Finals day 4", Start: time.Date(2026, 3, 16, 0, 0, 0, 0, jst), Cutoff: time.Date(2026, 3, 17, 0, 0, 0, 0, jst)},
+	}
+	equal := func(a, b gwDay) bool {
+		return a.Name == b.Name && a.Start.Equal(b.Start) && a.Cutoff.Equal(b.Cutoff)
+	}
+	if !slices.EqualFunc(schedule.Days, want, equal) {
+		t.Errorf("got %v, want %v", schedule.Days, want)
+	}
+}
+
+func TestFindRound(t *testing.T) {
+	date := time.Date(2026, 3, 14, 23, 59, 0, 0, jst)
+	tests := []struct {
+		name   string
+		rounds [][]string
+		want   []string
+	}{
+		{name: "ISO date", rounds: [][]string{{"2026-03-13", "1"}, {"2026-03-14", "2"}}, want: []string{"2026-03-14", "2"}},
+		{name: "slashes", rounds: [][]string{{"2026/03/14", "2"}}, want: []string{"2026/03/14", "2"}},
+		{name: "month and day", rounds: [][]string{{" 3/14 ", "2"}}, want: []string{" 3/14 ", "2"}},
+		{name: "month name", rounds: [][]string{{"Mar 14", "2"}}, want: []string{"Mar 14", "2"}},
+		{name: "not there yet", rounds: [][]string{{"2026-03-13", "1"}}},
+		{name: "not a date", rounds: [][]string{{"Finals", "1"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := findRound(test.rounds, date); !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+	// The date is taken in JST, where it is already the 15th.
+	if got := findRound([][]string{{"2026-03-15", "3"}}, time.Date(2026, 3, 14, 15, 30, 0, 0, time.UTC)); got == nil {
+		t.Error("findRound did not use the date in JST")
+	}
+}
+
+func TestParseRound(t *testing.T) {
+	rank, daily, total := parseRound([]string{"2026-03-14", " 1234 ", "12,345,678", "98,765,432"})
+	if rank != 1234 || daily != 12345678 || total != 98765432 {
+		t.Errorf("got %d, %d, %d", rank, daily, total)
+	}
+}
+
+func TestRoundCutoff(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, jst)
+	tests := []struct {
+		date   string
+		want   time.Time
+		wantOk bool
+	}{
+		{date: "2026-01-01", want: time.Date(2026, 1, 2, 0, 0, 0, 0, jst), wantOk: true},
+		{date: "2026/01/02", want: time.Date(2026, 1, 3, 0, 0, 0, 0, jst), wantOk: true},
+		{date: "1/2", want: time.Date(2026, 1, 3, 0, 0, 0, 0, jst), wantOk: true},
+		// Without a year, a date after today is from last year.
+		{date: "Dec 31", want: time.Date(2026, 1, 1, 0, 0, 0, 0, jst), wantOk: true},
+		{date: "Finals"},
+	}
+	for _, test := range tests {
+		got, ok := roundCutoff([]string{test.date}, now)
+		if ok != test.wantOk || !got.Equal(test.want) {
+			t.Errorf("roundCutoff(%q) = %v, %v, want %v, %v", test.date, got, ok, test.want, test.wantOk)
+		}
+	}
+}
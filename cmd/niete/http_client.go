@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	outboundTimeout = 15 * time.Second
+	// Servers asking to wait longer than this before retrying are not retried,
+	// so that the command waiting for them does not hang.
+	outboundMaxRetryAfter = outboundTimeout
+	outboundRetries       = 3
+	outboundBackoff       = 500 * time.Millisecond
+	defaultHostDelay      = 200 * time.Millisecond
+	// Stale entries are kept around for a day so they can be revalidated with
+	// a conditional request instead of downloaded again.
+	staleCacheRetention = 24 * time.Hour
+)
+
+// Minimum time between two requests to the same host.
+var hostDelays = map[string]time.Duration{
+	"gbfdata.com":   time.Second,
+	"gbf.gw.lt":     time.Second,
+	"safebooru.org": time.Second,
+	"localhost":     0,
+}
+
+// httpStatusError is returned when a request gets a response that is neither
+// successful nor worth retrying.
+type httpStatusError struct {
+	StatusCode int
+	URL        string
+	Body       []byte
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("request to %s failed with status %d", e.URL, e.StatusCode)
+}
+
+type outboundRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+	// Successful responses are cached for TTL. Zero disables caching.
+	TTL time.Duration
+}
+
+type cachedResponse struct {
+	Key          string    `bson:"key"`
+	Body         []byte    `bson:"body"`
+	ETag         string    `bson:"etag"`
+	LastModified string    `bson:"lastModified"`
+	Expires      time.Time `bson:"expires"`
+}
+
+type hostLimiter struct {
+	mutex sync.Mutex
+	delay time.Duration
+	next  time.Time
+}
+
+// wait blocks until the host can be called again and books the next slot.
+func (l *hostLimiter) wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.delay)
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(slot.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// outboundClient is used for every request to the community data sources and
+// APIs the bot relies on. It rate limits requests per host, retries failures
+// with exponential backoff and caches responses in memory and, optionally, in
+// MongoDB.
+type outboundClient struct {
+	client       *http.Client
+	limitersLock sync.Mutex
+	limiters     map[string]*hostLimiter
+	cacheLock    sync.Mutex
+	cache        map[string]*cachedResponse
+	mongoCache   *mongo.Collection
+}
+
+var web = newOutboundClient()
+
+func newOutboundClient() *outboundClient {
+	return &outboundClient{
+		client:   &http.Client{Timeout: outboundTimeout},
+		limiters: make(map[string]*hostLimiter),
+		cache:    make(map[string]*cachedResponse),
+	}
+}
+
+// useMongoCache makes the cache survive restarts by storing it in collection.
+func (c *outboundClient) useMongoCache(collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"key": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"expires": 1}, Options: options.Index().SetExpireAfterSeconds(int32(staleCacheRetention.Seconds()))},
+	})
+	if err != nil {
+		return err
+	}
+	c.mongoCache = collection
+	return nil
+}
+
+func (c *outboundClient) limiter(host string) *hostLimiter {
+	c.limitersLock.Lock()
+	defer c.limitersLock.Unlock()
+	limiter, ok := c.limiters[host]
+	if !ok {
+		delay, found := hostDelays[host]
+		if !found {
+			delay = defaultHostDelay
+		}
+		limiter = &hostLimiter{delay: delay}
+		c.limiters[host] = limiter
+	}
+	return limiter
+}
+
+func cacheKey(request outboundRequest) string {
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL + "\n"))
+	hash.Write(request.Body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *outboundClient) cached(key string) *cachedResponse {
+	c.cacheLock.Lock()
+	entry, ok := c.cache[key]
+	c.cacheLock.Unlock()
+	if ok || c.mongoCache == nil {
+		return entry
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	entry = &cachedResponse{}
+	if err := c.mongoCache.FindOne(ctx, bson.M{"key": key}).Decode(entry); err != nil {
+		return nil
+	}
+	c.cacheLock.Lock()
+	c.cache[key] = entry
+	c.cacheLock.Unlock()
+	return entry
+}
+
+func (c *outboundClient) store(entry *cachedResponse) {
+	c.cacheLock.Lock()
+	c.cache[entry.Key] = entry
+	for key, cached := range c.cache {
+		if time.Since(cached.Expires) > staleCacheRetention {
+			delete(c.cache, key)
+		}
+	}
+	c.cacheLock.Unlock()
+	if c.mongoCache == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := c.mongoCache.ReplaceOne(ctx, bson.M{"key": entry.Key}, entry, options.Replace().SetUpsert(true))
+	if err != nil {
+		logger.Printf("Could not store %s in the HTTP cache: %v\n", entry.Key, err)
+	}
+}
+
+// idempotent tells whether a request can be sent again after a failure that
+// may have happened once the server had already processed it.
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// retryable tells whether a request can be sent again after the given
+// response. Other requests, like the translations the APIs bill for, are only
+// retried when the server did not process them: when it asks to slow down or
+// says when it will be back.
+func retryable(method string, response *http.Response) bool {
+	if idempotent(method) {
+		return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+	}
+	return response.StatusCode == http.StatusTooManyRequests ||
+		response.StatusCode == http.StatusServiceUnavailable && response.Header.Get("Retry-After") != ""
+}
+
+// retryDelay returns how long to wait before the given retry, honoring the
+// Retry-After header if the server sent one.
+func retryDelay(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return outboundBackoff << attempt
+}
+
+// fetch sends the request, or answers it from the cache.
+func (c *outboundClient) fetch(request outboundRequest) ([]byte, error) {
+	body, _, err := c.fetchNew(request)
+	return body, err
+}
+
+// fetchNew is fetch that also tells whether the body was just downloaded,
+// rather than taken from the cache or confirmed unchanged by the server.
+func (c *outboundClient) fetchNew(request outboundRequest) ([]byte, bool, error) {
+	if request.Method == "" {
+		request.Method = http.MethodGet
+	}
+	parsedURL, err := url.Parse(request.URL)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := cacheKey(request)
+	var entry *cachedResponse
+	if request.TTL > 0 {
+		entry = c.cached(key)
+		if entry != nil && time.Now().Before(entry.Expires) {
+			return entry.Body, false, nil
+		}
+	}
+
+	var lastErr error
+	var delay time.Duration
+	for attempt := 0; attempt <= outboundRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), outboundTimeout)
+		if err = c.limiter(parsedURL.Hostname()).wait(ctx); err != nil {
+			cancel()
+			return nil, false, err
+		}
+		httpRequest, err := http.NewRequestWithContext(ctx, request.Method, request.URL, bytes.NewReader(request.Body))
+		if err != nil {
+			cancel()
+			return nil, false, err
+		}
+		for name, values := range request.Header {
+			httpRequest.Header[name] = values
+		}
+		if entry != nil {
+			if entry.ETag != "" {
+				httpRequest.Header.Set("If-None-Match", entry.ETag)
+			}
+			if entry.LastModified != "" {
+				httpRequest.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+
+		response, err := c.client.Do(httpRequest)
+		if err != nil {
+			cancel()
+			if !idempotent(request.Method) {
+				return nil, false, err
+			}
+			lastErr = err
+			delay = retryDelay(attempt, nil)
+			continue
+		}
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		cancel()
+		if err != nil {
+			if !idempotent(request.Method) {
+				return nil, false, err
+			}
+			lastErr = err
+			delay = retryDelay(attempt, nil)
+			continue
+		}
+
+		switch {
+		case response.StatusCode == http.StatusNotModified && entry != nil:
+			refreshed := *entry
+			refreshed.Expires = time.Now().Add(request.TTL)
+			c.store(&refreshed)
+			return refreshed.Body, false, nil
+		case response.StatusCode >= 200 && response.StatusCode < 300:
+			if request.TTL > 0 {
+				c.store(&cachedResponse{
+					Key:          key,
+					Body:         body,
+					ETag:         response.Header.Get("ETag"),
+					LastModified: response.Header.Get("Last-Modified"),
+					Expires:      time.Now().Add(request.TTL),
+				})
+			}
+			return body, true, nil
+		case retryable(request.Method, response):
+			lastErr = &httpStatusError{StatusCode: response.StatusCode, URL: request.URL, Body: body}
+			delay = retryDelay(attempt, response)
+			if delay > outboundMaxRetryAfter {
+				return nil, false, lastErr
+			}
+		default:
+			return nil, false, &httpStatusError{StatusCode: response.StatusCode, URL: request.URL, Body: body}
+		}
+	}
+	return nil, false, lastErr
+}
+
+func (c *outboundClient) get(url string, ttl time.Duration) ([]byte, error) {
+	return c.fetch(outboundRequest{URL: url, TTL: ttl})
+}
+
+func (c *outboundClient) postJSON(url string, payload any, ttl time.Duration) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetch(outboundRequest{
+		Method: http.MethodPost,
+		URL:    url,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   body,
+		TTL:    ttl,
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer serves the responses in order, repeating the last one, and
+// counts the requests. Its URL uses localhost, which is not rate limited.
+func newFlakyServer(t *testing.T, responses ...func(w http.ResponseWriter)) (string, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1)) - 1
+		responses[min(n, len(responses)-1)](w)
+	}))
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "127.0.0.1", "localhost", 1), &requests
+}
+
+func respond(status int, header ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(http.StatusText(status)))
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	// A Retry-After of 0 keeps the retries from waiting.
+	unavailable := respond(http.StatusServiceUnavailable, "Retry-After", "0")
+	tests := []struct {
+		name         string
+		method       string
+		responses    []func(w http.ResponseWriter)
+		wantStatus   int
+		wantRequests int32
+	}{
+		{
+			name:         "GET after an error",
+			method:       http.MethodGet,
+			responses:    []func(w http.ResponseWriter){respond(http.StatusInternalServerError, "Retry-After", "0"), respond(http.StatusOK)},
+			wantRequests: 2,
+		},
+		{
+			name:         "GET giving up",
+			method:       http.MethodGet,
+			responses:    []func(w http.ResponseWriter){unavailable},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantRequests: outboundRetries + 1,
+		},
+		{
+			name:         "GET not found",
+			method:       http.MethodGet,
+			responses:    []func(w http.ResponseWriter){respond(http.StatusNotFound)},
+			wantStatus:   http.StatusNotFound,
+			wantRequests: 1,
+		},
+		{
+			name:         "POST after too many requests",
+			method:       http.MethodPost,
+			responses:    []func(w http.ResponseWriter){respond(http.StatusTooManyRequests, "Retry-After", "0"), respond(http.StatusOK)},
+			wantRequests: 2,
+		},
+		{
+			name:         "POST after unavailable with Retry-After",
+			method:       http.MethodPost,
+			responses:    []func(w http.ResponseWriter){unavailable, respond(http.StatusOK)},
+			wantRequests: 2,
+		},
+		{
+			name:         "POST after unavailable",
+			method:       http.MethodPost,
+			responses:    []func(w http.ResponseWriter){respond(http.StatusServiceUnavailable), respond(http.StatusOK)},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantRequests: 1,
+		},
+		{
+			name:         "POST after an error",
+			method:       http.MethodPost,
+			responses:    []func(w http.ResponseWriter){respond(http.StatusInternalServerError, "Retry-After", "0"), respond(http.StatusOK)},
+			wantStatus:   http.StatusInternalServerError,
+			wantRequests: 1,
+		},
+		{
+			name:         "Retry-After too long",
+			method:       http.MethodGet,
+			responses:    []func(w http.ResponseWriter){respond(http.StatusTooManyRequests, "Retry-After", "3600"), respond(http.StatusOK)},
+			wantStatus:   http.StatusTooManyRequests,
+			wantRequests: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url, requests := newFlakyServer(t, test.responses...)
+			_, err := newOutboundClient().fetch(outboundRequest{Method: test.method, URL: url})
+			var statusErr *httpStatusError
+			switch {
+			case test.wantStatus == 0 && err != nil:
+				t.Errorf("got %v", err)
+			case test.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != test.wantStatus):
+				t.Errorf("got %v, want status %d", err, test.wantStatus)
+			}
+			if got := requests.Load(); got != test.wantRequests {
+				t.Errorf("sent %d requests, want %d", got, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestFetchTransportError(t *testing.T) {
+	url, _ := newFlakyServer(t, respond(http.StatusOK))
+	client := newOutboundClient()
+	var attempts int
+	client.client.Transport = roundTripFunc(func(*http.Request) (*http.Response, error) {
+		attempts++
+		return nil, errors.New("connection reset")
+	})
+	if _, err := client.fetch(outboundRequest{Method: http.MethodPost, URL: url}); err == nil {
+		t.Error("the POST did not fail")
+	}
+	if attempts != 1 {
+		t.Errorf("the POST was sent %d times", attempts)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestFetchCache(t *testing.T) {
+	var requests, revalidations atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("body"))
+	}))
+	t.Cleanup(server.Close)
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	client := newOutboundClient()
+
+	for range 2 {
+		body, err := client.get(url, time.Minute)
+		if err != nil || string(body) != "body" {
+			t.Fatalf("got %q, %v", body, err)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("sent %d requests for a fresh cache entry", requests.Load())
+	}
+
+	// Once it expires, it is revalidated instead of downloaded again.
+	client.cache[cacheKey(outboundRequest{Method: http.MethodGet, URL: url})].Expires = time.Now().Add(-time.Second)
+	body, err := client.get(url, time.Minute)
+	if err != nil || string(body) != "body" {
+		t.Fatalf("got %q, %v after revalidating", body, err)
+	}
+	if revalidations.Load() != 1 {
+		t.Errorf("revalidated %d times", revalidations.Load())
+	}
+
+	// Without a TTL nothing is cached.
+	requests.Store(0)
+	client.get(url+"/uncached", 0)
+	client.get(url+"/uncached", 0)
+	if requests.Load() != 2 {
+		t.Errorf("sent %d requests without a TTL", requests.Load())
+	}
+}
@@ -5,27 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"math"
 	"math/rand"
-	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/go-rod/rod/lib/proto"
-	"github.com/mattn/go-runewidth"
-
 	dgo "github.com/bwmarrin/discordgo"
-	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -54,12 +47,11 @@ type crewAPIData struct {
 }
 
 var (
-	discordToken, allowedChannels, translationForbiddenChannels, deeplKey, myCrew, ngrokPath, mcDirPath string
-	mongoClient                                                                                         *mongo.Client
-	ngrokProcess                                                                                        *os.Process
-	logger                                                                                              log.Logger
-	mcURLMessage                                                                                        *dgo.Message
-	mcCmd                                                                                               *exec.Cmd
+	discordToken, allowedChannels, translationForbiddenChannels, deeplKey, myCrew string
+	mongoClient                                                                   *mongo.Client
+	translators                                                                   translator
+	tweets                                                                        tweetFetcher
+	logger                                                                        log.Logger
 )
 
 func intComma(i int) string {
@@ -72,6 +64,13 @@ func intComma(i int) string {
 	return intComma(i/1000) + "," + fmt.Sprintf("%03d", i%1000)
 }
 
+func signedIntComma(i int64) string {
+	if i >= 0 {
+		return "+" + intComma(int(i))
+	}
+	return intComma(int(i))
+}
+
 func getDatabase() *mongo.Database {
 	return mongoClient.Database("db")
 }
@@ -86,6 +85,29 @@ func sendHelp(session *dgo.Session, channel string) error {
 		"\t- $spark add [crystals|xtals|tickets|ticket|tix|10part] <number>: Add some amount to your pulls.\n" +
 		"\t- $bless: Ask immunity Lily for her blessing before pulling (might and will go wrong).\n" +
 		"\t- $gw <crew_name>: Retrieves past performances of the specified crew in GW.\n" +
+		"\t- $gw quota [day|round] <honors|off>: Set the honors each member should get per day or per round.\n" +
+		"\t- $gw snapshot: Save the current honors of every member of the crew.\n" +
+		"\t- $gw report [day|round] [csv]: Show who met the quota and the crew's total, optionally as a CSV file.\n" +
+		"\t- $shame [crew alias] [by rank|honors|level|name] [position captain|vice|officers|members] [missing] [--top N]: Show the GW ranking of the crew's members.\n" +
+		"\t- $gw border [tier]: Estimate the honors needed to reach the prelims cutoffs and compare them with ours.\n" +
+		"\t- $gw watch [crew]: Get alerts in this channel when the crew changes tier, lands in our bracket or beats our daily honors. Without a crew, list the watched ones.\n" +
+		"\t- $gw unwatch <crew>: Stop watching a crew.\n" +
+		"\t- $crew [list|add <alias> <crew id>|remove <alias>|set <alias|crew id> [here]|unset here]: Manage the crews of the server and which one is used by default, in the server or in this channel.\n" +
+		"\t- $config translate [mode off|auto|reaction|request|lang <code>|formality <formality>|sources <codes...>|emoji <emoji>|reset]: Show or change how tweets are translated in this channel.\n" +
+		"\t- $glossary [list|add <jp> <en>|remove <jp>|preview <text>]: Manage how names and terms are translated in this server, or compare a translation with and without the glossary.\n" +
+		"\t- $hc [cmd <command>|say <message>|whitelist add|remove <name>|whitelist list|save|list]: Send a command to the HC server. Only for the HC admins.\n" +
+		"\t- $hcstatus: Show whether the HC server is up, its version, MOTD, players and latency.\n" +
+		"\t- $server [list|start <name>|stop <name>|status <name>]: List the game servers, start or stop one, or show whether it is up.\n" +
+		"\t- $translate [LANG] <text>: Translate a text, to your language unless another one is given in upper case, like DE or PT-BR.\n" +
+		"\t- $translate lang [code]: Show or set the language your translations are in. It is also used by the Translate entry of the message menu.\n" +
+		"\t- $translate stats: Show how many tweet translations came from the cache and the characters saved.\n" +
+		"\t- Add --crew <alias> to the $gw and $roster commands to use another crew of the server.\n" +
+		"\t- $link [gbf user id]: Link your Discord account to your GBF account once an officer approves it, or show the current link.\n" +
+		"\t- $link approve <@user>: Approve the link a member asked for. Officers only.\n" +
+		"\t- $unlink: Remove the link to your GBF account.\n" +
+		"\t- $roster [sync [force]|announce]: Show the crew's members, sync them now, or announce joiners and leavers in this channel.\n" +
+		"\t- $gw schedule [<gw number> <YYYY-MM-DD>]: Show or set the GW whose daily results are posted in this channel.\n" +
+		"\t- $gw opponent <finals day> <crew>: Set our opponent for a finals day.\n" +
 		"```"
 	// _, e := session.ChannelMessageSend(channel, helpString)
 	return nil
@@ -159,7 +181,8 @@ func sendPlayerData(session *dgo.Session, channel string, data map[string]any) (
 }
 
 func createPlayerDocument(session *dgo.Session, channel string, discordId string, players *mongo.Collection) error {
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	/*
 		_, err := session.ChannelMessageSend(channel, "Profile not found. Creating...")
 		if err != nil {
@@ -176,7 +199,8 @@ func createPlayerDocument(session *dgo.Session, channel string, discordId string
 func createOrRetrievePlayerData(session *dgo.Session, channel string, discordId string, name string) error {
 	var playerDataDict map[string]any
 	collection := getDatabase().Collection("players")
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	result, err := collection.FindOne(ctx, bson.M{"discordId": discordId}).Raw()
 	err = bson.Unmarshal(result, &playerDataDict)
 	if err != nil {
@@ -189,7 +213,8 @@ func createOrRetrievePlayerData(session *dgo.Session, channel string, discordId
 }
 
 func setQuantity(discordId, field string, quantity int, players *mongo.Collection) error {
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	_, err := players.UpdateOne(ctx,
 		bson.M{"discordId": discordId},
 		bson.M{"$set": bson.M{field: quantity}},
@@ -198,7 +223,8 @@ func setQuantity(discordId, field string, quantity int, players *mongo.Collectio
 }
 
 func addQuantity(discordId, field string, quantity int, players *mongo.Collection) error {
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	_, err := players.UpdateOne(ctx,
 		bson.M{"discordId": discordId},
 		bson.M{"$inc": bson.M{field: quantity}},
@@ -249,7 +275,8 @@ func sparkUpdateHandler(session *dgo.Session, args []string, channel, discordId,
 	}
 	var playerDataDict map[string]any
 	collection := getDatabase().Collection("players")
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	result, err := collection.FindOne(ctx, bson.M{"discordId": discordId}).DecodeBytes()
 	var totalBefore int64 = 0
 	err = bson.Unmarshal(result, &playerDataDict)
@@ -301,15 +328,7 @@ func showTime(session *dgo.Session, channel string) error {
 }
 
 func getLastRoundsPerformance(crewId string) ([][]string, error) {
-	resp, err := http.Get("https://gbfdata.com/en/guild/" + crewId)
-
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	body, fresh, err := web.fetchNew(outboundRequest{URL: "https://gbfdata.com/en/guild/" + crewId, TTL: 5 * time.Minute})
 
 	if err != nil {
 		return nil, err
@@ -352,21 +371,33 @@ func getLastRoundsPerformance(crewId string) ([][]string, error) {
 		roundRow = roundRow.NextSibling.NextSibling
 	}
 
+	// Cached rounds were already recorded when they were fetched.
+	if fresh {
+		recordCrewSnapshot(crewId, rounds, time.Now())
+	}
+
 	return rounds, err
 }
 
-func getCrewGWMembers(crewId string) ([]userRankingData, error) {
-	url := fmt.Sprintf("https://gbfdata.com/api/guilds/%s/members", crewId)
-
-	resp, err := http.Get(url)
+func newRoundsTable() *textTable {
+	return newTextTable(
+		tableColumn{Header: "Date"},
+		tableColumn{Header: "Rank", AlignRight: true},
+		tableColumn{Header: "Daily Honors", AlignRight: true},
+		tableColumn{Header: "Total Honors", AlignRight: true},
+	)
+}
 
-	if err != nil {
-		return nil, err
-	}
+func getCrewGWMembers(crewId string) ([]userRankingData, error) {
+	return fetchCrewGWMembers(crewId, 2*time.Minute)
+}
 
-	defer resp.Body.Close()
+// fetchCrewGWMembers returns the members of the crew, from the cache if they
+// were fetched less than ttl ago. With a zero ttl they are always fetched.
+func fetchCrewGWMembers(crewId string, ttl time.Duration) ([]userRankingData, error) {
+	url := fmt.Sprintf("https://gbfdata.com/api/guilds/%s/members", crewId)
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := web.get(url, ttl)
 
 	if err != nil {
 		return nil, err
@@ -382,80 +413,197 @@ func getCrewGWMembers(crewId string) ([]userRankingData, error) {
 	return jsonData.MembersData, err
 }
 
-func getPlayersRanking(session *dgo.Session, channel, crewID string) error {
-	players, err := getCrewGWMembers(crewID)
-	if err != nil {
-		return err
+type shameOptions struct {
+	crew     string
+	sortBy   string
+	position string
+	missing  bool
+	top      int
+}
+
+// Values of member_position in the members API.
+var memberPositions = map[string][]uint{
+	"captain":  {1},
+	"vice":     {2},
+	"officers": {1, 2},
+	"members":  {3},
+}
+
+func parseShameArgs(args []string) (shameOptions, error) {
+	opts := shameOptions{sortBy: "rank"}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "by":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("missing sort field")
+			}
+			i++
+			switch args[i] {
+			case "rank", "honors", "level", "name":
+				opts.sortBy = args[i]
+			default:
+				return opts, fmt.Errorf("unknown sort field %q", args[i])
+			}
+		case "position":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("missing position")
+			}
+			i++
+			if _, ok := memberPositions[args[i]]; !ok {
+				return opts, fmt.Errorf("unknown position %q", args[i])
+			}
+			opts.position = args[i]
+		case "missing":
+			opts.missing = true
+		case "--top":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("missing amount for --top")
+			}
+			i++
+			top, err := strconv.Atoi(args[i])
+			if err != nil || top < 1 {
+				return opts, fmt.Errorf("invalid amount for --top: %q", args[i])
+			}
+			opts.top = top
+		default:
+			if opts.crew != "" {
+				return opts, fmt.Errorf("unknown option %q", args[i])
+			}
+			opts.crew = args[i]
+		}
 	}
+	return opts, nil
+}
 
-	sort.Slice(players, func(i, j int) bool {
-		if players[i].Ranking == nil {
+func filterAndSortPlayers(players []userRankingData, opts shameOptions) []userRankingData {
+	filtered := make([]userRankingData, 0, len(players))
+	for _, player := range players {
+		if opts.missing && player.HasRanking {
+			continue
+		}
+		if opts.position != "" && !slices.Contains(memberPositions[opts.position], player.MemberPosition) {
+			continue
+		}
+		filtered = append(filtered, player)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if opts.sortBy == "name" {
+			return strings.ToLower(filtered[i].Name) < strings.ToLower(filtered[j].Name)
+		}
+		if filtered[i].Ranking == nil {
 			return false
 		}
-		if players[j].Ranking == nil {
+		if filtered[j].Ranking == nil {
 			return true
 		}
-		return players[i].Ranking.Rank < players[j].Ranking.Rank
+		switch opts.sortBy {
+		case "honors":
+			return filtered[i].Ranking.Point > filtered[j].Ranking.Point
+		case "level":
+			return filtered[i].Ranking.Level > filtered[j].Ranking.Level
+		default:
+			return filtered[i].Ranking.Rank < filtered[j].Ranking.Rank
+		}
 	})
 
-	message := "```\n   Player\t\t Rank\t  GW rank     Total Honors\n"
+	if opts.top > 0 && len(filtered) > opts.top {
+		filtered = filtered[:opts.top]
+	}
+	return filtered
+}
+
+func getPlayersRanking(session *dgo.Session, channel, guild string, args []string) error {
+	opts, err := parseShameArgs(args)
+	if err != nil {
+		_, err = session.ChannelMessageSend(
+			channel,
+			"Usage: `$shame [crew alias] [by rank|honors|level|name] [position captain|vice|officers|members] [missing] [--top N]`",
+		)
+		return err
+	}
+	crewID, err := resolveCrew(guild, channel, opts.crew)
+	if err != nil {
+		_, err = session.ChannelMessageSend(channel, fmt.Sprintf("There is no crew `%s` in this server.", opts.crew))
+		return err
+	}
+	if crewID == "" {
+		_, err = session.ChannelMessageSend(channel, "There is no crew configured. Use `$crew set <crew id>`.")
+		return err
+	}
+
+	players, err := getCrewGWMembers(crewID)
+	if err != nil {
+		return err
+	}
+	players = filterAndSortPlayers(players, opts)
+
+	title := "Wall of shame"
+	if opts.missing {
+		title = "Missing in action"
+	}
+	if opts.sortBy != "rank" {
+		title += " by " + opts.sortBy
+	}
+	if len(players) == 0 {
+		_, err = session.ChannelMessageSend(channel, "Nobody matches that.")
+		return err
+	}
 
+	table := newTextTable(
+		tableColumn{Header: "#", AlignRight: true},
+		tableColumn{Header: "Player", MaxWidth: 15},
+		tableColumn{Header: "Rank", AlignRight: true},
+		tableColumn{Header: "GW rank", AlignRight: true},
+		tableColumn{Header: "Total Honors", AlignRight: true},
+	)
 	for n, player := range players {
-		message += fmt.Sprint(n+1) + "."
-		if n+1 < 10 {
-			message += " "
-		}
-		message += player.Name + strings.Repeat(" ", 15-runewidth.StringWidth(player.Name))
-		if runewidth.StringWidth(player.Name) < len(player.Name) {
-			message += " "
-		}
 		if player.Ranking == nil {
-			message += "No data.  No data.    No data."
-		} else {
-			message += fmt.Sprint(player.Ranking.Level) +
-				strings.Repeat(" ", 9-int(math.Log10(float64(player.Ranking.Level)))) +
-				fmt.Sprint(player.Ranking.Rank) +
-				strings.Repeat(" ", 11-int(math.Log10(float64(player.Ranking.Rank)))) +
-				fmt.Sprint(player.Ranking.Point)
+			table.addRow(fmt.Sprint(n+1), player.Name, "No data", "No data", "No data")
+			continue
 		}
-		message += "\n"
+		table.addRow(
+			fmt.Sprint(n+1),
+			player.Name,
+			fmt.Sprint(player.Ranking.Level),
+			intComma(int(player.Ranking.Rank)),
+			intComma(int(player.Ranking.Point)),
+		)
 	}
-	message += "```"
-
-	embedMessage := dgo.MessageEmbed{Description: message, Title: "Wall of shame"}
-	_, err = session.ChannelMessageSendEmbed(channel, &embedMessage)
 
-	return err
+	return sendTable(session, channel, title, "", "", table)
 }
 
-func searchGWOpponent(session *dgo.Session, channel, opponent string) error {
-	if opponent == "" {
-		_, err := session.ChannelMessageSend(channel, "Please input a crew's name.")
-		return err
+func searchCrews(name string) ([]any, error) {
+	values := map[string]string{"search": name}
+	body, err := web.postJSON("http://gbf.gw.lt/gw-guild-searcher/search", values, 10*time.Minute)
+	if err != nil {
+		return nil, err
 	}
 
-	values := map[string]string{"search": opponent}
-	jsonData, err := json.Marshal(values)
-	resp, err := http.Post(
-		"http://gbf.gw.lt/gw-guild-searcher/search",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	var data map[string]any
+	err = json.Unmarshal(body, &data)
 	if err != nil {
-		_, _ = session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return nil, err
+	}
+	result, ok := data["result"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response from the crew searcher")
+	}
+	return result, nil
+}
+
+func searchGWOpponent(session *dgo.Session, channel, ourCrew, opponent string) error {
+	if opponent == "" {
+		_, err := session.ChannelMessageSend(channel, "Please input a crew's name.")
 		return err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	result, err := searchCrews(opponent)
 	if err != nil {
 		_, _ = session.ChannelMessageSend(channel, "Sorry, something went wrong.")
 		return err
 	}
-
-	var data map[string]any
-	err = json.Unmarshal(body, &data)
-	result := data["result"].([]any)
 	if len(result) == 0 {
 		_, err = session.ChannelMessageSend(channel, "Crew not found.")
 		return err
@@ -481,27 +629,28 @@ func searchGWOpponent(session *dgo.Session, channel, opponent string) error {
 		crewData := crewMap["data"].([]any)
 		crewId := fmt.Sprintf("%.f", crewMap["id"].(float64))
 
-		message := "[__Crew's page__](http://game.granbluefantasy.jp/#guild/detail/" + crewId + ")\n```\n"
+		crewPage := "[__Crew's page__](http://game.granbluefantasy.jp/#guild/detail/" + crewId + ")"
+		history := newTextTable(
+			tableColumn{Header: "GW", AlignRight: true},
+			tableColumn{Header: "Name", MaxWidth: 20},
+			tableColumn{Header: "Rank", AlignRight: true},
+			tableColumn{Header: "Points", AlignRight: true},
+		)
 		for _, gwData := range crewData {
 			unpackedData := gwData.(map[string]any)
 			points := unpackedData["points"]
 			if points == nil {
 				continue
 			}
-			message = message + fmt.Sprintf(
-				"%s - Ranked #%d in GW #%d with %s points\n",
-				unpackedData["name"],
-				int(unpackedData["rank"].(float64)),
-				int(unpackedData["gw_num"].(float64)),
+			history.addRow(
+				fmt.Sprintf("#%d", int(unpackedData["gw_num"].(float64))),
+				fmt.Sprint(unpackedData["name"]),
+				intComma(int(unpackedData["rank"].(float64))),
 				intComma(int(points.(float64))),
 			)
 		}
-		message = message + "```"
-		embeddedMessage := dgo.MessageEmbed{
-			Description: message,
-		}
 
-		_, err = session.ChannelMessageSendEmbed(channel, &embeddedMessage)
+		err = sendTable(session, channel, "", crewPage, "", history)
 
 		if err != nil {
 			session.ChannelMessageSend(channel, "Sorry, something went wrong when retrieving the data.")
@@ -515,50 +664,40 @@ func searchGWOpponent(session *dgo.Session, channel, opponent string) error {
 			continue
 		}
 
-		message = "```\nDate\t\t\tRank\tDaily Honors      Total Honors\n"
+		performance := newRoundsTable()
 		for _, round := range rounds {
-			message += round[0] + "\t" + round[1] + strings.Repeat(" ", 8-len(round[1])) + round[2] + strings.Repeat(" ", 18-len(round[2])) + round[3] + "\n"
+			performance.addRow(round[0], round[1], round[2], round[3])
 		}
-		message += "```\n"
+		err = sendTable(session, channel, "Crew's performance", "", "", performance)
 
-		embedMessage := dgo.MessageEmbed{Description: message, Title: "Crew's performance"}
-		_, err = session.ChannelMessageSendEmbed(channel, &embedMessage)
+		if ourCrew == "" {
+			time.Sleep(time.Second)
+			continue
+		}
 
-		myRounds, err := getLastRoundsPerformance(myCrew)
+		myRounds, err := getLastRoundsPerformance(ourCrew)
 
 		if err != nil {
 			session.ChannelMessageSend(channel, "Could not retrieve last rounds performance for our crew.")
 			continue
 		}
 
-		message = "```\nDate\t\t\tRank\tDaily Honors      Total Honors\n"
+		comparison := newRoundsTable()
 		for n, round := range myRounds {
-			opponentRound := rounds[n]
-			opponentRank, _ := strconv.ParseInt(opponentRound[1], 10, 64)
-			opponentDaily, _ := strconv.ParseInt(strings.ReplaceAll(opponentRound[2], ",", ""), 10, 64)
-			opponentTotal, _ := strconv.ParseInt(strings.ReplaceAll(opponentRound[3], ",", ""), 10, 64)
-			ourRank, _ := strconv.ParseInt(round[1], 10, 64)
-			ourDaily, _ := strconv.ParseInt(strings.ReplaceAll(round[2], ",", ""), 10, 64)
-			ourTotal, _ := strconv.ParseInt(strings.ReplaceAll(round[3], ",", ""), 10, 64)
-			rankDifference := ourRank - opponentRank
-			rankDifferenceString := strconv.Itoa(int(rankDifference))
-			if rankDifference >= 0 {
-				rankDifferenceString = "+" + rankDifferenceString
+			if n >= len(rounds) {
+				break
 			}
-			dailyDifference := intComma(int(ourDaily - opponentDaily))
-			if ourDaily-opponentDaily >= 0 {
-				dailyDifference = "+" + dailyDifference
-			}
-			totalDifference := intComma(int(ourTotal - opponentTotal))
-			if ourTotal-opponentTotal >= 0 {
-				totalDifference = "+" + totalDifference
-			}
-			message += round[0] + "\t" + rankDifferenceString + strings.Repeat(" ", 8-len(rankDifferenceString)) + dailyDifference + strings.Repeat(" ", 18-len(dailyDifference)) + totalDifference + "\n"
+			opponentRank, opponentDaily, opponentTotal := parseRound(rounds[n])
+			ourRank, ourDaily, ourTotal := parseRound(round)
+			comparison.addRow(
+				round[0],
+				signedIntComma(ourRank-opponentRank),
+				signedIntComma(ourDaily-opponentDaily),
+				signedIntComma(ourTotal-opponentTotal),
+			)
 		}
-		message += "```\n"
 
-		embedMessage = dgo.MessageEmbed{Description: message, Title: "Our crew vs " + opponent}
-		_, err = session.ChannelMessageSendEmbed(channel, &embedMessage)
+		err = sendTable(session, channel, "Our crew vs "+opponent, "", "", comparison)
 
 		time.Sleep(time.Second)
 	}
@@ -566,6 +705,38 @@ func searchGWOpponent(session *dgo.Session, channel, opponent string) error {
 	return nil
 }
 
+func gwHandler(session *dgo.Session, channel, guild string, args []string) error {
+	args, alias := extractCrewOption(args)
+	crewId, err := resolveCrew(guild, channel, alias)
+	if err != nil {
+		_, err = session.ChannelMessageSend(channel, fmt.Sprintf("There is no crew `%s` in this server.", alias))
+		return err
+	}
+	if len(args) == 0 {
+		return searchGWOpponent(session, channel, crewId, "")
+	}
+	switch args[0] {
+	case "report":
+		return sendGWReport(session, channel, crewId, args[1:])
+	case "quota":
+		return setHonorQuota(session, channel, crewId, args[1:])
+	case "snapshot":
+		return sendMemberSnapshot(session, channel, crewId)
+	case "schedule":
+		return gwScheduleHandler(session, channel, crewId, args[1:])
+	case "opponent":
+		return gwOpponentHandler(session, channel, crewId, args[1:])
+	case "border":
+		return sendBorderEstimate(session, channel, crewId, args[1:])
+	case "watch":
+		return watchCrew(session, channel, guild, args[1:])
+	case "unwatch":
+		return unwatchCrew(session, channel, guild, args[1:])
+	default:
+		return searchGWOpponent(session, channel, crewId, strings.Join(args, " "))
+	}
+}
+
 func bless(session *dgo.Session, channel string) error {
 	var filename string
 	if rand.Int()%2 == 1 {
@@ -583,133 +754,116 @@ func bless(session *dgo.Session, channel string) error {
 	return err
 }
 
-func translate(session *dgo.Session, channel, message string) error {
-	logger.Println("Translating tweet in following message:\n" + message)
-	urlRegex, err := regexp.Compile(`https://(?:www\.|mobile\.)?(?:twitter|x)\.com/\S+/status/\d+`)
+// translateTweet returns the tweet and its translation with the glossary
+// applied, following the policy of the channel, from the cache if it has been
+// translated before. It returns nil if there is nothing to translate.
+func translateTweet(id, URL string, policy *translationPolicy, terms *glossary) (*cachedTranslation, error) {
+	opts := policy.options()
+	cached, err := getCachedTranslation(id, opts, terms.hash())
 	if err != nil {
-		return err
+		logger.Printf("Could not read the translation cache: %v\n", err)
 	}
-	urls := urlRegex.FindAllString(message, -1)
-	logger.Printf("Found %d urls:\n", len(urls))
-	logger.Printf("%v\n", urls)
-	for _, URL := range urls {
-		path, _ := launcher.LookPath()
-		currentLauncher := launcher.New()
-		defer currentLauncher.Kill()
-		u := currentLauncher.Bin(path).Headless(true).MustLaunch()
-		browser := rod.New().ControlURL(u).MustConnect()
-		defer browser.MustClose()
-
-		logger.Println("Browser connected. Opening page...")
-
-		page, err := browser.Page(proto.TargetCreateTarget{URL: URL})
-		if err != nil {
-			return err
-		}
-
-		logger.Println("Page opened. Waiting for load...")
-
-		//wait := page.MustWaitRequestIdle()
-		page.MustWaitDOMStable()
-
-		logger.Println("Load completed. Finding tweet elements...")
-
-		spanElements := page.MustElements("span")
-
-		if len(spanElements) < 2 {
-			return fmt.Errorf("couldn't find the right elements in the tweet")
-		}
-
-		var tweetTextElement *rod.Element
-
-		if ariaLabel, _ := spanElements[0].Attribute("aria-label"); ariaLabel != nil {
-			if class, _ := spanElements[1].Attribute("class"); *class == "contents" {
-				logger.Println("Empty tweet")
-				return nil
-			} else {
-
-				tweetTextElement = spanElements[1]
-			}
-		} else {
-			if class, _ := spanElements[0].Attribute("class"); *class == "contents" {
-				logger.Println("Empty tweet")
-				return nil
-			} else {
-				tweetTextElement = spanElements[0]
-			}
-		}
-
-		logger.Println("Found tweet element. Obtaining text")
-
-		tweetText, err := tweetTextElement.Text()
-		if err != nil {
-			return err
+	if cached != nil {
+		logger.Println("Translation of tweet " + id + " found in the cache")
+		if !policy.allows(cached.Translation.SourceLanguage) {
+			return nil, nil
 		}
+		recordTranslation(true, cached.Translation.Characters)
+		return cached, nil
+	}
 
-		logger.Println("Text found: " + tweetText)
+	logger.Println("Fetching tweet " + id)
 
-		toEraseRegex, err := regexp.Compile(`https://t\.co/[0-9a-zA-Z]+`)
-		if err != nil {
-			return err
-		}
-
-		logger.Println("Requesting translation...")
+	status, err := tweets.fetch(id, URL)
+	if err != nil {
+		return nil, err
+	}
+	if status.Text == "" {
+		logger.Println("Empty tweet")
+		return nil, nil
+	}
 
-		tweetText = toEraseRegex.ReplaceAllString(tweetText, "")
-		payload, _ := json.Marshal(map[string]any{"text": [1]string{tweetText}, "target_lang": "EN", "formality": "prefer_less"})
-		request, _ := http.NewRequest("POST", "https://api-free.deepl.com/v2/translate", bytes.NewReader(payload))
-		request.Header.Add("Content-Type", "application/json")
-		request.Header.Add("Authorization", fmt.Sprintf("DeepL-Auth-Key %s", deeplKey))
+	logger.Println("Text found: " + status.Text)
 
-		client := &http.Client{
-			Timeout: time.Second * 10, // Timeout each requests
-		}
+	toEraseRegex, err := regexp.Compile(`https://t\.co/[0-9a-zA-Z]+`)
+	if err != nil {
+		return nil, err
+	}
 
-		deeplResponse, err := client.Do(request)
-		if err != nil {
-			return err
-		}
-		defer deeplResponse.Body.Close()
+	tweetText := strings.TrimSpace(toEraseRegex.ReplaceAllString(status.Text, ""))
+	if tweetText == "" {
+		logger.Println("The tweet only has links")
+		return nil, nil
+	}
+	if sameLanguage(status.Language, opts.TargetLanguage) {
+		logger.Println("The tweet is already in " + opts.TargetLanguage + ", no need to post the translation")
+		return nil, nil
+	}
+	if !policy.allows(status.Language) {
+		logger.Println("Tweets in " + status.Language + " are not translated in this channel")
+		return nil, nil
+	}
 
-		logger.Println("Response received. Parsing...")
+	logger.Println("Requesting translation...")
 
-		deeplResponseData := make(map[string][]map[string]string)
+	result, err := translateWithGlossary(tweetText, terms, opts)
+	if err != nil {
+		return nil, err
+	}
 
-		// testData := make(map[string]string)
-		// testBody, _ := io.ReadAll(deeplResponse.Body)
-		// json.Unmarshal(testBody, &testData)
-		// fmt.Println(testData)
-		body, err := io.ReadAll(deeplResponse.Body)
-		if err != nil {
-			return err
-		}
-		err = json.Unmarshal(body, &deeplResponseData)
-		if err != nil {
-			return err
-		}
+	logger.Println("Translation received from " + result.Translator)
 
-		if deeplResponseData["translations"][0]["detected_source_language"] == "EN" {
-			logger.Println("The tweet was in English, no need to post the translation")
-			return nil
-		}
+	if sameLanguage(result.SourceLanguage, opts.TargetLanguage) {
+		logger.Println("The tweet is already in " + opts.TargetLanguage + ", no need to post the translation")
+		return nil, nil
+	}
 
-		translatedTweet := html.UnescapeString(deeplResponseData["translations"][0]["text"])
+	logger.Println("Translation obtained: " + result.Text)
 
-		logger.Println("Translation obtained: " + translatedTweet)
+	cached = &cachedTranslation{
+		TweetId:        id,
+		TargetLanguage: opts.TargetLanguage,
+		Formality:      opts.Formality,
+		GlossaryHash:   terms.hash(),
+		Tweet:          status,
+		Original:       tweetText,
+		Translation:    result,
+	}
+	recordTranslation(false, result.Characters)
+	if err = saveCachedTranslation(cached); err != nil {
+		logger.Printf("Could not save the translation of tweet %s: %v\n", id, err)
+	}
+	if !policy.allows(result.SourceLanguage) {
+		logger.Println("Tweets in " + result.SourceLanguage + " are not translated in this channel")
+		return nil, nil
+	}
+	return cached, nil
+}
 
-		embeddedURLsRegex, err := regexp.Compile(`http(?:s)?:\/\/\S+`)
+// translate replies to a message with the translation of the tweets it links.
+func translate(session *dgo.Session, m *dgo.Message, policy *translationPolicy) error {
+	logger.Println("Translating tweet in following message:\n" + m.Content)
+	urls := tweetURLRegex.FindAllString(m.Content, -1)
+	logger.Printf("Found %d urls:\n", len(urls))
+	logger.Printf("%v\n", urls)
+	terms, err := getGlossary(m.GuildID)
+	if err != nil {
+		logger.Printf("Could not get the glossary of guild %s: %v\n", m.GuildID, err)
+	}
+	for _, URL := range urls {
+		id, _ := tweetId(URL)
+		cached, err := translateTweet(id, URL, policy, terms)
 		if err != nil {
 			return err
 		}
-
-		embeddedURLs := embeddedURLsRegex.FindAllString(translatedTweet, 10)
-
-		for _, embeddedURL := range embeddedURLs {
-			newURL := fmt.Sprintf("<%s>", strings.TrimSuffix(embeddedURL, "..."))
-			translatedTweet = strings.Replace(translatedTweet, embeddedURL, newURL, 1)
+		if cached == nil {
+			continue
 		}
-
-		_, err = session.ChannelMessageSend(channel, translatedTweet)
+		_, err = session.ChannelMessageSendComplex(m.ChannelID, &dgo.MessageSend{
+			Embeds:          []*dgo.MessageEmbed{tweetEmbed(cached.Tweet, cached.Original, cached.Translation)},
+			Reference:       m.SoftReference(),
+			AllowedMentions: &dgo.MessageAllowedMentions{},
+		})
 		if err != nil {
 			return err
 		}
@@ -717,100 +871,21 @@ func translate(session *dgo.Session, channel, message string) error {
 	return nil
 }
 
-func startHC(session *dgo.Session, channel string) error {
-	// Run ngrok first
-	if ngrokProcess != nil {
-		session.ChannelMessageSend(channel, "The server is already up")
-		return nil
-	}
-	cmd := exec.Command(ngrokPath, "tcp", "25565", "--region", "eu")
-	err := cmd.Start()
-	if err != nil {
-		session.ChannelMessageSend(channel, "Something went wrong with the server startup. Ping my creator.")
-		return err
-	}
-	ngrokProcess = cmd.Process
-	time.Sleep(2 * time.Second)
-	resp, err := http.Get("http://localhost:4040/api/tunnels")
-	if err != nil {
-		session.ChannelMessageSend(channel, "Something went wrong with the server startup. Ping my creator.")
-		return err
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		session.ChannelMessageSend(channel, "Something went wrong with the server startup. Ping my creator.")
-		return err
-	}
-	responseData := make(map[string]any)
-	err = json.Unmarshal(body, &responseData)
+// autoTranslate translates the tweets in a message if the channel translates
+// them as soon as they are posted.
+func autoTranslate(session *dgo.Session, m *dgo.Message) error {
+	policy, err := getTranslationPolicy(session, m.GuildID, m.ChannelID)
 	if err != nil {
-		session.ChannelMessageSend(channel, "Something went wrong with the server startup. Ping my creator.")
 		return err
 	}
-	// Then run the MC server
-	if mcCmd != nil {
-		session.ChannelMessageSend(channel, "The server is already up")
+	if policy.Mode != translationAuto {
 		return nil
 	}
-	mcCmd = exec.Command("python3", "quick.py")
-	mcCmd.Dir = mcDirPath
-	mcCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	// stdout, stdoutErr := mcCmd.StdoutPipe()
-	// stderr, stderrErr := mcCmd.StderrPipe()
-	err = mcCmd.Start()
-	if err != nil {
-		session.ChannelMessageSend(channel, "Something went wrong with the server startup. Ping my creator.")
-		ngrokProcess.Kill()
-		return err
-	}
-	serverURL := responseData["tunnels"].([]any)[0].(map[string]any)["public_url"].(string)
-	serverURL = strings.TrimPrefix(serverURL, "tcp://")
-	mcURLMessage, err = session.ChannelMessageSend(channel, fmt.Sprintf("`%s`", serverURL))
-	/*
-		buff := make([]byte, 1000)
-		for stdoutErr == nil {
-			_, stdoutErr = stdout.Read(buff)
-			fmt.Println(string(buff[:]))
-		}
-	*/
-	return err
-}
-
-func stopHC(session *dgo.Session, channel string) error {
-	if ngrokProcess == nil {
-		session.ChannelMessageSend(channel, "There is no server running")
-		return nil
-	}
-	message, _ := session.ChannelMessageSend(channel, "Stopping the server...")
-	err := ngrokProcess.Kill()
-	if err != nil {
-		session.ChannelMessageSend(channel, "Something went wrong stopping the server. Ping my creator.")
-		return err
-	}
-	ngrokProcess.Wait()
-	ngrokProcess = nil
-	if mcCmd == nil {
-		session.ChannelMessageSend(channel, "There is no server running")
-		return nil
-	}
-	err = syscall.Kill(-mcCmd.Process.Pid, syscall.SIGINT)
-	if err != nil {
-		session.ChannelMessageSend(channel, "Something went wrong stopping the server. Ping my creator.")
-		return err
-	}
-	mcCmd.Process.Wait()
-	mcCmd = nil
-	session.ChannelMessageDelete(mcURLMessage.ChannelID, mcURLMessage.ID)
-	session.ChannelMessageEdit(message.ChannelID, message.ID, "Server stopped.")
-	return err
+	return translate(session, m, policy)
 }
 
 func postSuiseiPic(session *dgo.Session, channel string) error {
-	resp, err := http.Get("https://safebooru.org/index.php?page=dapi&s=post&q=index&tags=hoshimachi_suisei&limit=0&pid=0")
-	if err != nil {
-		return err
-	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := web.get("https://safebooru.org/index.php?page=dapi&s=post&q=index&tags=hoshimachi_suisei&limit=0&pid=0", time.Hour)
 	if err != nil {
 		return err
 	}
@@ -823,11 +898,7 @@ func postSuiseiPic(session *dgo.Session, channel string) error {
 	posts := matches[1]
 	postsInt, _ := strconv.ParseInt(posts, 10, 64)
 	chosenPost := rand.Intn(int(postsInt))
-	resp, err = http.Get(fmt.Sprintf("https://safebooru.org/index.php?page=dapi&s=post&q=index&tags=hoshimachi_suisei&limit=1&pid=%d", chosenPost))
-	if err != nil {
-		return err
-	}
-	body, err = io.ReadAll(resp.Body)
+	body, err = web.get(fmt.Sprintf("https://safebooru.org/index.php?page=dapi&s=post&q=index&tags=hoshimachi_suisei&limit=1&pid=%d", chosenPost), 0)
 	if err != nil {
 		return err
 	}
@@ -864,8 +935,11 @@ func messageHandler(session *dgo.Session, m *dgo.MessageCreate) {
 	}
 	message := strings.Trim(m.Content, " ")
 	var e error
-	if strings.Contains(message, "twitter.com") || strings.Contains(message, "x.com") && !strings.Contains(translationForbiddenChannels, m.ChannelID) {
-		e = translate(session, m.ChannelID, message)
+	if m.ChannelID == hcLogChannel && !m.Author.Bot && !strings.HasPrefix(message, "$") {
+		e = relayChat(m.Message)
+	}
+	if tweetURLRegex.MatchString(message) && !strings.HasPrefix(message, "$translate") {
+		e = autoTranslate(session, m.Message)
 	}
 	if strings.HasPrefix(message, "$suisex") {
 		e = postSuiseiPic(session, m.ChannelID)
@@ -881,10 +955,19 @@ func messageHandler(session *dgo.Session, m *dgo.MessageCreate) {
 	}
 	if allowed {
 		if strings.HasPrefix(message, "$starthc") {
-			e = startHC(session, m.ChannelID)
+			e = serverHandler(session, m.ChannelID, "start hc")
 		}
 		if strings.HasPrefix(message, "$stophc") {
-			e = stopHC(session, m.ChannelID)
+			e = serverHandler(session, m.ChannelID, "stop hc")
+		}
+		if strings.HasPrefix(message, "$hcstatus") {
+			e = serverHandler(session, m.ChannelID, "status hc")
+		}
+		if after, ok := strings.CutPrefix(message, "$server"); ok && (after == "" || after[0] == ' ') {
+			e = serverHandler(session, m.ChannelID, after)
+		}
+		if after, ok := strings.CutPrefix(message, "$hc"); ok && (after == "" || after[0] == ' ') {
+			e = hcHandler(session, m.Message, after)
 		}
 		if strings.HasPrefix(message, "$help") {
 			e = sendHelp(session, m.ChannelID)
@@ -918,11 +1001,37 @@ func messageHandler(session *dgo.Session, m *dgo.MessageCreate) {
 			}
 		}
 		if after, ok := strings.CutPrefix(message, "$gw"); ok {
-			opponent := strings.Trim(after, " ")
-			e = searchGWOpponent(session, m.ChannelID, opponent)
+			e = gwHandler(session, m.ChannelID, m.GuildID, strings.Fields(after))
+		}
+		if after, ok := strings.CutPrefix(message, "$link"); ok {
+			e = linkHandler(session, m.ChannelID, m.Author.ID, strings.Fields(after))
+		}
+		if strings.HasPrefix(message, "$unlink") {
+			e = unlinkHandler(session, m.ChannelID, m.Author.ID)
+		}
+		if after, ok := strings.CutPrefix(message, "$roster"); ok {
+			args, alias := extractCrewOption(strings.Fields(after))
+			crewId, err := resolveCrew(m.GuildID, m.ChannelID, alias)
+			if err != nil {
+				_, e = session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("There is no crew `%s` in this server.", alias))
+			} else {
+				e = rosterHandler(session, m.ChannelID, crewId, args)
+			}
+		}
+		if after, ok := strings.CutPrefix(message, "$shame"); ok {
+			e = getPlayersRanking(session, m.ChannelID, m.GuildID, strings.Fields(after))
+		}
+		if after, ok := strings.CutPrefix(message, "$crew"); ok {
+			e = crewHandler(session, m.ChannelID, m.GuildID, m.Author.ID, strings.Fields(after))
+		}
+		if after, ok := strings.CutPrefix(message, "$config"); ok {
+			e = configHandler(session, m.ChannelID, m.GuildID, m.Author.ID, strings.Fields(after))
 		}
-		if strings.HasPrefix(message, "$shame") {
-			e = getPlayersRanking(session, m.ChannelID, myCrew)
+		if after, ok := strings.CutPrefix(message, "$glossary"); ok {
+			e = glossaryHandler(session, m.ChannelID, m.GuildID, m.Author.ID, strings.Fields(after))
+		}
+		if after, ok := strings.CutPrefix(message, "$translate"); ok {
+			e = translateHandler(session, m.Message, after)
 		}
 	}
 	if e != nil {
@@ -946,18 +1055,10 @@ func main() {
 	envVariables := []string{
 		"NIETE_TOKEN",
 		"NIETE_CHANNELS",
-		"TRANSLATION_FORBIDDEN_CHANNELS",
-		"DEEPL_KEY",
-		"NGROK_PATH",
-		"MC_DIR_PATH",
 	}
 	variables := []*string{
 		&discordToken,
 		&allowedChannels,
-		&translationForbiddenChannels,
-		&deeplKey,
-		&ngrokPath,
-		&mcDirPath,
 	}
 	for i := range envVariables {
 		e := getToken(variables[i], envVariables[i])
@@ -970,20 +1071,97 @@ func main() {
 	if e != nil {
 		myCrew = ""
 	}
+	getToken(&translationForbiddenChannels, "TRANSLATION_FORBIDDEN_CHANNELS")
+	getToken(&deeplKey, "DEEPL_KEY")
+	getToken(&ocrSpaceKey, "OCR_SPACE_KEY")
+	getToken(&hcStatusChannel, "HC_STATUS_CHANNEL")
+	getToken(&hcLogChannel, "HC_LOG_CHANNEL")
+	getToken(&hcLogPath, "HC_LOG_PATH")
+	getToken(&rconPassword, "RCON_PASSWORD")
+	getToken(&hcAdminRole, "HC_ADMIN_ROLE")
+	var port string
+	if getToken(&port, "RCON_PORT") == nil {
+		if rconPort, e = strconv.Atoi(port); e != nil {
+			fmt.Println("RCON_PORT is not a number: ", e)
+			return
+		}
+	}
+	if getToken(&port, "HC_PORT") == nil {
+		if hcPort, e = strconv.Atoi(port); e != nil {
+			fmt.Println("HC_PORT is not a number: ", e)
+			return
+		}
+	}
+	serversConfig := defaultServersConfig
+	getToken(&serversConfig, "SERVERS_CONFIG")
+	if e = setupServers(serversConfig); e != nil {
+		fmt.Println("An error occurred when setting up the game servers: ", e)
+		return
+	}
+	var idleMinutes, schedule, timezone string
+	if getToken(&idleMinutes, "HC_IDLE_MINUTES") == nil {
+		minutes, err := strconv.Atoi(idleMinutes)
+		if err != nil || minutes < 0 {
+			fmt.Println("HC_IDLE_MINUTES is not a number of minutes: ", idleMinutes)
+			return
+		}
+		hcSchedule.idle = time.Duration(minutes) * time.Minute
+	}
+	if getToken(&schedule, "HC_SCHEDULE") == nil {
+		if hcSchedule.windows, e = parseSchedule(schedule); e != nil {
+			fmt.Println("HC_SCHEDULE is not valid: ", e)
+			return
+		}
+	}
+	if getToken(&timezone, "HC_TIMEZONE") == nil {
+		if hcSchedule.location, e = time.LoadLocation(timezone); e != nil {
+			fmt.Println("HC_TIMEZONE is not valid: ", e)
+			return
+		}
+	}
+	translators, e = newTranslator()
+	if e != nil {
+		fmt.Println("An error occurred when setting up the translators: ", e)
+		return
+	}
+	tweets = newTweetFetcher()
 	session, e := dgo.New("Bot " + discordToken)
 	if e != nil {
 		fmt.Println("An error occurred when opening a connection to Discord: ", e)
 		return
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 	mongoClient, e = mongo.Connect(ctx, options.Client().ApplyURI("mongodb://db:27017"))
 	if e != nil {
 		fmt.Println("An error occurred when connecting to mongodb: ", e)
 		return
 	}
+	var httpCacheMongo string
+	if getToken(&httpCacheMongo, "HTTP_CACHE_MONGO") == nil && httpCacheMongo == "true" {
+		e = web.useMongoCache(getDatabase().Collection("httpCache"))
+		if e != nil {
+			fmt.Println("An error occurred when setting up the HTTP cache: ", e)
+			return
+		}
+	}
+	if e = setupTranslationCache(); e != nil {
+		fmt.Println("An error occurred when setting up the translation cache: ", e)
+		return
+	}
+	if e = setupAccountLinks(); e != nil {
+		fmt.Println("An error occurred when setting up the account links: ", e)
+		return
+	}
+	if e = setupTranslatedMessages(); e != nil {
+		fmt.Println("An error occurred when setting up the translated messages: ", e)
+		return
+	}
 
 	// Register the messageCreate func as a callback for MessageCreate events.
 	session.AddHandler(messageHandler)
+	session.AddHandler(reactionHandler)
+	session.AddHandler(interactionHandler)
 
 	// Open a websocket connection to Discord and begin listening.
 	e = session.Open()
@@ -1002,6 +1180,33 @@ func main() {
 	logger.SetOutput(logFile)
 	defer logFile.Close()
 
+	if e = registerCommands(session); e != nil {
+		fmt.Println("An error occurred when registering the application commands: ", e)
+	}
+
+	for _, server := range sortedServers() {
+		if e = server.reconcile(session); e != nil {
+			fmt.Printf("An error occurred when reconciling the state of server %s: %v\n", server.config.Name, e)
+		}
+	}
+
+	runEvery("daily snapshots", time.Minute, takeDailySnapshots)
+	runEvery("gw summaries", 5*time.Minute, func() error { return postGWSummaries(session) })
+	runEvery("roster sync", time.Hour, func() error { return syncRosterJobs(session) })
+	runEvery("watchlist", 15*time.Minute, func() error { return pollWatchlist(session) })
+	runEvery("server status", 5*time.Minute, func() error {
+		for _, server := range sortedServers() {
+			server.refreshStatus(session)
+		}
+		return nil
+	})
+	if hc != nil {
+		go hcLogs.run(session)
+		runEvery("hc schedule", mcSchedulePeriod, hc.followSchedule(session, hcSchedule))
+	}
+	runEvery("browser health check", browserHealthCheckInterval, browsers.healthCheck)
+	defer browsers.stop()
+
 	// Wait here until CTRL-C or other term signal is received.
 	fmt.Println("Bot is now running.  Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger = *log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+func TestParseShameArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    shameOptions
+		wantErr bool
+	}{
+		{args: nil, want: shameOptions{sortBy: "rank"}},
+		{args: []string{"123456"}, want: shameOptions{crew: "123456", sortBy: "rank"}},
+		{
+			args: []string{"123456", "by", "honors", "position", "officers", "missing", "--top", "5"},
+			want: shameOptions{crew: "123456", sortBy: "honors", position: "officers", missing: true, top: 5},
+		},
+		{args: []string{"by", "name"}, want: shameOptions{sortBy: "name"}},
+		{args: []string{"by"}, wantErr: true},
+		{args: []string{"by", "age"}, wantErr: true},
+		{args: []string{"position"}, wantErr: true},
+		{args: []string{"position", "janitor"}, wantErr: true},
+		{args: []string{"--top"}, wantErr: true},
+		{args: []string{"--top", "0"}, wantErr: true},
+		{args: []string{"--top", "five"}, wantErr: true},
+		{args: []string{"123456", "654321"}, wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseShameArgs(test.args)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseShameArgs(%q) = %+v, want an error", test.args, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseShameArgs(%q) = %+v, %v, want %+v", test.args, got, err, test.want)
+		}
+	}
+}
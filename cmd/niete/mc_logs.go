@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+const (
+	mcLogMaxSize = 10 << 20
+	mcLogBackups = 3
+	// Relayed lines are sent together at most this often, so that a busy
+	// server does not get the bot rate limited.
+	mcRelayInterval = 2 * time.Second
+	mcRelayQueue    = 200
+	// The longest Discord message that is relayed to the server.
+	mcChatMaxLength = 256
+)
+
+var (
+	// [12:34:56] [Server thread/INFO]: message, with an optional logger name
+	// after the thread in modded servers.
+	mcLogLineRegex = regexp.MustCompile(`^\[[\d:]+\] \[Server thread/INFO\](?: \[[^\]]+\])?: (.*)$`)
+	mcJoinRegex    = regexp.MustCompile(`^(\w{1,16}) joined the game$`)
+	mcLeaveRegex   = regexp.MustCompile(`^(\w{1,16}) left the game$`)
+	mcChatRegex    = regexp.MustCompile(`^(?:\[Not Secure\] )?<(\w{1,16})> (.*)$`)
+	// The beginnings of the vanilla death messages.
+	mcDeathRegex = regexp.MustCompile(
+		`^(\w{1,16}) (was |drowned|died|fell |blew up|burned to death|hit the ground|went |walked into|tried to swim|experienced kinetic energy|froze to death|starved to death|suffocated|withered away|discovered the floor|left the confines|didn't want to live)`,
+	)
+	hcLogChannel string
+)
+
+// rotatingFile is a log file that is moved to path.1 once it grows past
+// maxSize, keeping up to backups old files.
+type rotatingFile struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	for i := f.backups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Write(data []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(data)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	return n, err
+}
+
+// mcLogEvent turns a line of the server's output into the message relayed to
+// Discord. It returns false for the lines that are not relayed.
+func mcLogEvent(line string) (string, bool) {
+	match := mcLogLineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	message := match[1]
+	if chat := mcChatRegex.FindStringSubmatch(message); chat != nil {
+		return fmt.Sprintf("💬 **%s**: %s", chat[1], chat[2]), true
+	}
+	if join := mcJoinRegex.FindStringSubmatch(message); join != nil {
+		return fmt.Sprintf("📥 **%s** joined the game", join[1]), true
+	}
+	if leave := mcLeaveRegex.FindStringSubmatch(message); leave != nil {
+		return fmt.Sprintf("📤 **%s** left the game", leave[1]), true
+	}
+	if mcDeathRegex.MatchString(message) {
+		return "💀 " + message, true
+	}
+	return "", false
+}
+
+// mcLogRelay writes the output of the server to the log file and relays the
+// interesting lines to HC_LOG_CHANNEL.
+type mcLogRelay struct {
+	file   *rotatingFile
+	events chan string
+}
+
+// hcLogs is given the log file of the HC server by setupServers.
+var hcLogs = &mcLogRelay{events: make(chan string, mcRelayQueue)}
+
+// mcOutput splits the output of one run of the server into lines.
+type mcOutput struct {
+	mutex   sync.Mutex
+	relay   *mcLogRelay
+	partial []byte
+}
+
+// output returns the writer for the stdout and stderr of a new run of the
+// server.
+func (r *mcLogRelay) output() *mcOutput {
+	return &mcOutput{relay: r}
+}
+
+func (o *mcOutput) Write(data []byte) (int, error) {
+	if _, err := o.relay.file.Write(data); err != nil {
+		logger.Printf("Could not write the server log: %v\n", err)
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.partial = append(o.partial, data...)
+	for {
+		end := bytes.IndexByte(o.partial, '\n')
+		if end < 0 {
+			break
+		}
+		line := strings.TrimRight(string(o.partial[:end]), "\r")
+		o.partial = o.partial[end+1:]
+		if event, ok := mcLogEvent(line); ok {
+			o.relay.enqueue(event)
+		}
+	}
+	return len(data), nil
+}
+
+// enqueue queues an event for Discord, dropping it if the queue is full.
+func (r *mcLogRelay) enqueue(event string) {
+	select {
+	case r.events <- truncateText(event, 500):
+	default:
+	}
+}
+
+// run sends the queued events to HC_LOG_CHANNEL, batching the ones that
+// arrive within mcRelayInterval of each other.
+func (r *mcLogRelay) run(session *dgo.Session) {
+	ticker := time.NewTicker(mcRelayInterval)
+	defer ticker.Stop()
+	var batch []string
+	for range ticker.C {
+	drain:
+		for {
+			select {
+			case event := <-r.events:
+				batch = append(batch, event)
+			default:
+				break drain
+			}
+		}
+		if len(batch) == 0 || hcLogChannel == "" {
+			batch = nil
+			continue
+		}
+		// If the server talks faster than it can be relayed, the oldest lines
+		// are dropped.
+		batch = batch[max(0, len(batch)-mcRelayQueue):]
+		// Whatever does not fit in a message waits for the next tick.
+		message, sent := "", 0
+		for _, event := range batch {
+			if len(message)+len(event)+1 > 2000 {
+				break
+			}
+			message += event + "\n"
+			sent++
+		}
+		batch = batch[sent:]
+		_, err := session.ChannelMessageSendComplex(hcLogChannel, &dgo.MessageSend{
+			Content:         message,
+			AllowedMentions: &dgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			logger.Printf("Could not relay the server log: %v\n", err)
+		}
+	}
+}
+
+// relayChat sends a message posted in HC_LOG_CHANNEL to the chat of the
+// server.
+func relayChat(m *dgo.Message) error {
+	if !hc.running() {
+		return nil
+	}
+	text := strings.Join(strings.Fields(m.ContentWithMentionsReplaced()), " ")
+	if len(m.Attachments) > 0 {
+		text = strings.TrimSpace(text + " [attachment]")
+	}
+	if text == "" {
+		return nil
+	}
+	name := m.Author.Username
+	if m.Member != nil && m.Member.Nick != "" {
+		name = m.Member.Nick
+	}
+	_, err := rconCommand(fmt.Sprintf("say [Discord] %s: %s", name, truncateText(text, mcChatMaxLength)))
+	return err
+}
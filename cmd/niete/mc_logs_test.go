@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestMcLogEvent(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   string
+		wantOk bool
+	}{
+		{line: "[18:02:11] [Server thread/INFO]: <Steve> hello there", want: "💬 **Steve**: hello there", wantOk: true},
+		{line: "[18:02:11] [Server thread/INFO]: [Not Secure] <Alex> hi", want: "💬 **Alex**: hi", wantOk: true},
+		{line: "[18:02:11] [Server thread/INFO]: Steve joined the game", want: "📥 **Steve** joined the game", wantOk: true},
+		{line: "[18:02:11] [Server thread/INFO]: Steve left the game", want: "📤 **Steve** left the game", wantOk: true},
+		{line: "[18:02:11] [Server thread/INFO]: Steve was slain by Zombie", want: "💀 Steve was slain by Zombie", wantOk: true},
+		{line: "[18:02:11] [Server thread/INFO]: Alex fell from a high place", want: "💀 Alex fell from a high place", wantOk: true},
+		{
+			line:   "[18:02:11] [Server thread/INFO] [net.minecraft.server.MinecraftServer]: Steve joined the game",
+			want:   "📥 **Steve** joined the game",
+			wantOk: true,
+		},
+		{line: "[18:02:11] [Server thread/INFO]: Done (5.123s)! For help, type \"help\""},
+		{line: "[18:02:11] [Server thread/WARN]: Can't keep up! Is the server overloaded?"},
+		{line: "[18:02:11] [User Authenticator #1/INFO]: UUID of player Steve is 1234"},
+		{line: "Starting minecraft server version 1.21"},
+	}
+	for _, test := range tests {
+		got, ok := mcLogEvent(test.line)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("mcLogEvent(%q) = %q, %v, want %q, %v", test.line, got, ok, test.want, test.wantOk)
+		}
+	}
+}
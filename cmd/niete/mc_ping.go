@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMCPort = 25565
+	mcPingTimeout = 5 * time.Second
+	// Any version works to ask for the status. -1 is what clients send when
+	// they do not know the version of the server.
+	mcProtocolVersion = -1
+)
+
+var mcFormattingRegex = regexp.MustCompile(`§.`)
+
+type mcPlayer struct {
+	Name string `json:"name"`
+	Id   string `json:"id"`
+}
+
+// mcStatus is the answer of a server to a Server List Ping.
+type mcStatus struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int        `json:"max"`
+		Online int        `json:"online"`
+		Sample []mcPlayer `json:"sample"`
+	} `json:"players"`
+	// A string or a chat component.
+	Description json.RawMessage `json:"description"`
+	Latency     time.Duration   `json:"-"`
+}
+
+type mcChatComponent struct {
+	Text  string            `json:"text"`
+	Extra []json.RawMessage `json:"extra"`
+}
+
+// chatText returns the plain text of a chat component, which is either a
+// string or an object with more components in extra.
+func chatText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var component mcChatComponent
+	if json.Unmarshal(raw, &component) != nil {
+		return ""
+	}
+	text = component.Text
+	for _, extra := range component.Extra {
+		text += chatText(extra)
+	}
+	return text
+}
+
+// motd returns the description of the server without formatting codes.
+func (s *mcStatus) motd() string {
+	return strings.TrimSpace(mcFormattingRegex.ReplaceAllString(chatText(s.Description), ""))
+}
+
+func appendVarInt(buffer []byte, value int32) []byte {
+	return binary.AppendUvarint(buffer, uint64(uint32(value)))
+}
+
+func appendMCString(buffer []byte, value string) []byte {
+	buffer = appendVarInt(buffer, int32(len(value)))
+	return append(buffer, value...)
+}
+
+// writePacket sends a packet: its length, its ID and its data.
+func writePacket(writer io.Writer, id int32, data []byte) error {
+	packet := appendVarInt(nil, id)
+	packet = append(packet, data...)
+	_, err := writer.Write(append(appendVarInt(nil, int32(len(packet))), packet...))
+	return err
+}
+
+// readPacket reads a packet and returns its ID and its data.
+func readPacket(reader *bufio.Reader) (int32, []byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length == 0 || length > 1<<21 {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err = io.ReadFull(reader, packet); err != nil {
+		return 0, nil, err
+	}
+	id, n := binary.Uvarint(packet)
+	if n <= 0 {
+		return 0, nil, errors.New("invalid packet ID")
+	}
+	return int32(id), packet[n:], nil
+}
+
+// pingMCServer asks the server at host:port for its status with the Server
+// List Ping protocol, and measures the latency with its ping.
+func pingMCServer(host string, port int) (*mcStatus, error) {
+	connection, err := net.DialTimeout("tcp", net.JoinHostPort(host, fmt.Sprint(port)), mcPingTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+	connection.SetDeadline(time.Now().Add(mcPingTimeout))
+	reader := bufio.NewReader(connection)
+
+	// Handshake, asking for the status, followed by the status request.
+	handshake := appendVarInt(nil, mcProtocolVersion)
+	handshake = appendMCString(handshake, host)
+	handshake = binary.BigEndian.AppendUint16(handshake, uint16(port))
+	handshake = appendVarInt(handshake, 1)
+	if err = writePacket(connection, 0x00, handshake); err != nil {
+		return nil, err
+	}
+	if err = writePacket(connection, 0x00, nil); err != nil {
+		return nil, err
+	}
+	id, data, err := readPacket(reader)
+	if err != nil {
+		return nil, err
+	}
+	if id != 0x00 {
+		return nil, fmt.Errorf("unexpected packet %#x instead of the status", id)
+	}
+	length, n := binary.Uvarint(data)
+	if n <= 0 || int(length) > len(data)-n {
+		return nil, errors.New("invalid status")
+	}
+	status := &mcStatus{}
+	if err = json.Unmarshal(data[n:n+int(length)], status); err != nil {
+		return nil, err
+	}
+
+	sent := time.Now()
+	if err = writePacket(connection, 0x01, binary.BigEndian.AppendUint64(nil, uint64(sent.UnixMilli()))); err != nil {
+		return nil, err
+	}
+	if id, _, err = readPacket(reader); err != nil {
+		// Some servers close the connection instead of answering the ping.
+		return status, nil
+	}
+	if id == 0x01 {
+		status.Latency = time.Since(sent)
+	}
+	return status, nil
+}
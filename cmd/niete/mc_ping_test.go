@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestMOTD(t *testing.T) {
+	tests := map[string]string{
+		`"§aA Minecraft Server"`:                                    "A Minecraft Server",
+		`{"text": "§lHC ", "extra": [{"text": "season 3"}, "§r!"]}`: "HC season 3!",
+		`{"extra": [{"text": "nested", "extra": [" text"]}]}`:       "nested text",
+		`42`: "",
+	}
+	for description, want := range tests {
+		status := &mcStatus{Description: json.RawMessage(description)}
+		if got := status.motd(); got != want {
+			t.Errorf("the MOTD of %s is %q, want %q", description, got, want)
+		}
+	}
+}
+
+func TestVarInt(t *testing.T) {
+	tests := map[int32][]byte{
+		0:   {0x00},
+		1:   {0x01},
+		127: {0x7f},
+		128: {0x80, 0x01},
+		// Negative numbers take the five bytes.
+		-1: {0xff, 0xff, 0xff, 0xff, 0x0f},
+	}
+	for value, want := range tests {
+		if got := appendVarInt(nil, value); !slices.Equal(got, want) {
+			t.Errorf("appendVarInt(%d) = %x, want %x", value, got, want)
+		}
+	}
+}
+
+func TestPacket(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := writePacket(&buffer, 0x01, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x05, 0x01, 'd', 'a', 't', 'a'}; !bytes.Equal(buffer.Bytes(), want) {
+		t.Errorf("wrote %x, want %x", buffer.Bytes(), want)
+	}
+	id, data, err := readPacket(bufio.NewReader(&buffer))
+	if err != nil || id != 0x01 || string(data) != "data" {
+		t.Errorf("read %#x, %q, %v", id, data, err)
+	}
+	if _, _, err = readPacket(bufio.NewReader(bytes.NewReader([]byte{0x00}))); err == nil {
+		t.Error("read an empty packet")
+	}
+}
+
+// fakeMCServer answers a Server List Ping with status, and the ping with a
+// pong if pong is set.
+func fakeMCServer(t *testing.T, status string, pong bool) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		reader := bufio.NewReader(connection)
+		// The handshake and the status request.
+		for range 2 {
+			if _, _, err = readPacket(reader); err != nil {
+				return
+			}
+		}
+		writePacket(connection, 0x00, appendMCString(nil, status))
+		id, data, err := readPacket(reader)
+		if err != nil || id != 0x01 || !pong {
+			return
+		}
+		writePacket(connection, 0x01, data)
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestPingMCServer(t *testing.T) {
+	const status = `{
+		"version": {"name": "1.21.1", "protocol": 767},
+		"players": {"max": 20, "online": 1, "sample": [{"name": "Steve", "id": "1"}]},
+		"description": {"text": "HC"}
+	}`
+	for _, pong := range []bool{true, false} {
+		t.Run("pong "+strconv.FormatBool(pong), func(t *testing.T) {
+			got, err := pingMCServer("127.0.0.1", fakeMCServer(t, status, pong))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version.Name != "1.21.1" || got.Players.Online != 1 || got.Players.Sample[0].Name != "Steve" || got.motd() != "HC" {
+				t.Errorf("got %+v", got)
+			}
+			if pong != (got.Latency > 0) {
+				t.Errorf("the latency is %v", got.Latency)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+const (
+	defaultRCONPort = 25575
+	rconTimeout     = 10 * time.Second
+	// The largest payload the server sends in a single packet.
+	rconMaxPayload = 4096
+
+	rconTypeResponse = 0
+	rconTypeCommand  = 2
+	rconTypeLogin    = 3
+)
+
+var (
+	rconPassword, hcAdminRole string
+	rconPort                  = defaultRCONPort
+	errRCONAuth               = errors.New("the RCON password was not accepted")
+)
+
+// rconClient talks to the server with the RCON protocol. Every packet is its
+// length, a request ID, a type and a null terminated payload, all little
+// endian.
+type rconClient struct {
+	connection net.Conn
+	lastId     int32
+}
+
+func dialRCON(address, password string) (*rconClient, error) {
+	connection, err := net.DialTimeout("tcp", address, rconTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := &rconClient{connection: connection}
+	id, err := client.send(rconTypeLogin, password)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	responseId, _, err := client.read()
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	// The server answers with -1 as the ID when the password is wrong.
+	if responseId != id {
+		connection.Close()
+		return nil, errRCONAuth
+	}
+	return client, nil
+}
+
+func (c *rconClient) close() error {
+	return c.connection.Close()
+}
+
+func (c *rconClient) send(packetType int32, payload string) (int32, error) {
+	c.lastId++
+	var packet bytes.Buffer
+	binary.Write(&packet, binary.LittleEndian, int32(4+4+len(payload)+2))
+	binary.Write(&packet, binary.LittleEndian, c.lastId)
+	binary.Write(&packet, binary.LittleEndian, packetType)
+	packet.WriteString(payload)
+	packet.Write([]byte{0, 0})
+	c.connection.SetDeadline(time.Now().Add(rconTimeout))
+	_, err := c.connection.Write(packet.Bytes())
+	return c.lastId, err
+}
+
+func (c *rconClient) read() (int32, string, error) {
+	c.connection.SetDeadline(time.Now().Add(rconTimeout))
+	var header struct {
+		Length int32
+		Id     int32
+		Type   int32
+	}
+	if err := binary.Read(c.connection, binary.LittleEndian, &header); err != nil {
+		return 0, "", err
+	}
+	if header.Length < 10 || header.Length > rconMaxPayload+10 {
+		return 0, "", fmt.Errorf("invalid RCON packet length %d", header.Length)
+	}
+	payload := make([]byte, header.Length-8)
+	if _, err := io.ReadFull(c.connection, payload); err != nil {
+		return 0, "", err
+	}
+	return header.Id, string(bytes.TrimRight(payload, "\x00")), nil
+}
+
+// command runs a command and returns its output. Long outputs come split in
+// several packets, so a second request is sent after the command: its answer
+// marks the end of the output.
+func (c *rconClient) command(command string) (string, error) {
+	id, err := c.send(rconTypeCommand, command)
+	if err != nil {
+		return "", err
+	}
+	end, err := c.send(rconTypeResponse, "")
+	if err != nil {
+		return "", err
+	}
+	var output strings.Builder
+	for {
+		responseId, payload, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		if responseId == end {
+			return output.String(), nil
+		}
+		if responseId == id {
+			output.WriteString(payload)
+		}
+	}
+}
+
+// rconCommand connects to the server, runs a command and disconnects.
+func rconCommand(command string) (string, error) {
+	if rconPassword == "" {
+		return "", errors.New("RCON_PASSWORD not set")
+	}
+	client, err := dialRCON(net.JoinHostPort("localhost", strconv.Itoa(rconPort)), rconPassword)
+	if err != nil {
+		return "", err
+	}
+	defer client.close()
+	return client.command(command)
+}
+
+// isHCAdmin tells whether the author of a message has the HC_ADMIN_ROLE role.
+func isHCAdmin(session *dgo.Session, m *dgo.Message) bool {
+	if hcAdminRole == "" || m.GuildID == "" {
+		return false
+	}
+	member := m.Member
+	if member == nil {
+		var err error
+		if member, err = session.GuildMember(m.GuildID, m.Author.ID); err != nil {
+			logger.Printf("Could not get the roles of %s: %v\n", m.Author.ID, err)
+			return false
+		}
+	}
+	return slices.Contains(member.Roles, hcAdminRole)
+}
+
+// running tells whether the server is up. There is no HC server when hc is
+// nil, and then it is never running.
+func (s *gameServer) running() bool {
+	if s == nil {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.record.State == serverRunning
+}
+
+// hcCommand turns the arguments of $hc into the command for the server.
+func hcCommand(args []string, text string) (string, bool) {
+	switch {
+	case len(args) > 1 && args[0] == "cmd":
+		return strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(text, "cmd")), "/"), true
+	case len(args) > 1 && args[0] == "say":
+		return "say " + strings.TrimSpace(strings.TrimPrefix(text, "say")), true
+	case len(args) == 3 && args[0] == "whitelist" && (args[1] == "add" || args[1] == "remove"):
+		return strings.Join(args, " "), true
+	case len(args) == 2 && args[0] == "whitelist" && args[1] == "list":
+		return "whitelist list", true
+	case len(args) == 1 && args[0] == "save":
+		return "save-all", true
+	case len(args) == 1 && args[0] == "list":
+		return "list", true
+	}
+	return "", false
+}
+
+// hcHandler handles $hc, which sends commands to the HC server through RCON.
+// text is everything after $hc.
+func hcHandler(session *dgo.Session, m *dgo.Message, text string) error {
+	if !isHCAdmin(session, m) {
+		_, err := session.ChannelMessageSend(m.ChannelID, "Only the HC admins can send commands to the server.")
+		return err
+	}
+	text = strings.TrimSpace(text)
+	command, ok := hcCommand(strings.Fields(text), text)
+	if !ok {
+		_, err := session.ChannelMessageSend(
+			m.ChannelID,
+			"Usage: `$hc [cmd <command>|say <message>|whitelist add <name>|whitelist remove <name>|whitelist list|save|list]`",
+		)
+		return err
+	}
+	if !hc.running() {
+		_, err := session.ChannelMessageSend(m.ChannelID, "There is no server running")
+		return err
+	}
+
+	logger.Printf("%s sent %q to the server\n", m.Author.Username, command)
+	output, err := rconCommand(command)
+	if err != nil {
+		session.ChannelMessageSend(m.ChannelID, "Could not send the command to the server.")
+		return err
+	}
+	output = strings.TrimSpace(mcFormattingRegex.ReplaceAllString(output, ""))
+	if output == "" {
+		output = "Done."
+	} else {
+		output = "```\n" + truncateText(strings.ReplaceAll(output, "```", "'''"), 1900) + "\n```"
+	}
+	_, err = session.ChannelMessageSendComplex(m.ChannelID, &dgo.MessageSend{
+		Content:         output,
+		Reference:       m.SoftReference(),
+		AllowedMentions: &dgo.MessageAllowedMentions{},
+	})
+	return err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func writeRCONPacket(writer io.Writer, id, packetType int32, payload string) {
+	var packet bytes.Buffer
+	binary.Write(&packet, binary.LittleEndian, int32(4+4+len(payload)+2))
+	binary.Write(&packet, binary.LittleEndian, id)
+	binary.Write(&packet, binary.LittleEndian, packetType)
+	packet.WriteString(payload)
+	packet.Write([]byte{0, 0})
+	writer.Write(packet.Bytes())
+}
+
+// fakeRCONServer accepts password and answers every command with output, in
+// two packets like the long outputs of a real server.
+func fakeRCONServer(t *testing.T, password, output string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		for {
+			var header struct{ Length, Id, Type int32 }
+			if binary.Read(connection, binary.LittleEndian, &header) != nil {
+				return
+			}
+			payload := make([]byte, header.Length-8)
+			if _, err = io.ReadFull(connection, payload); err != nil {
+				return
+			}
+			switch header.Type {
+			case rconTypeLogin:
+				id := header.Id
+				if string(bytes.TrimRight(payload, "\x00")) != password {
+					id = -1
+				}
+				writeRCONPacket(connection, id, rconTypeCommand, "")
+			case rconTypeCommand:
+				half := len(output) / 2
+				writeRCONPacket(connection, header.Id, rconTypeResponse, output[:half])
+				writeRCONPacket(connection, header.Id, rconTypeResponse, output[half:])
+			case rconTypeResponse:
+				writeRCONPacket(connection, header.Id, rconTypeResponse, "")
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestRCONCommand(t *testing.T) {
+	const output = "There are 1 of a max of 20 players online: Steve"
+	client, err := dialRCON(fakeRCONServer(t, "secret", output), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.close()
+	for range 2 {
+		if got, err := client.command("list"); err != nil || got != output {
+			t.Errorf("got %q, %v, want %q", got, err, output)
+		}
+	}
+}
+
+func TestRCONWrongPassword(t *testing.T) {
+	_, err := dialRCON(fakeRCONServer(t, "secret", ""), "guess")
+	if !errors.Is(err, errRCONAuth) {
+		t.Errorf("got %v with a wrong password", err)
+	}
+}
+
+func TestHCCommand(t *testing.T) {
+	tests := []struct {
+		text, command string
+		ok            bool
+	}{
+		{"cmd /time set day", "time set day", true},
+		{"cmd weather clear", "weather clear", true},
+		{"say hello  everyone", "say hello  everyone", true},
+		{"whitelist add Steve", "whitelist add Steve", true},
+		{"whitelist remove Steve", "whitelist remove Steve", true},
+		{"whitelist list", "whitelist list", true},
+		{"save", "save-all", true},
+		{"list", "list", true},
+		{"cmd", "", false},
+		{"whitelist add", "", false},
+		{"stop", "", false},
+	}
+	for _, test := range tests {
+		command, ok := hcCommand(strings.Fields(test.text), test.text)
+		if command != test.command || ok != test.ok {
+			t.Errorf("hcCommand(%q) = %q, %v, want %q, %v", test.text, command, ok, test.command, test.ok)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// How often the idle time and the schedule of the server are checked.
+const mcSchedulePeriod = time.Minute
+
+// scheduleWindow is a time of the day the server should be up, in minutes
+// since midnight. It can go past midnight, ending before it starts.
+type scheduleWindow struct {
+	start, end int
+}
+
+func (w scheduleWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+func (w scheduleWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+// mcSchedule is when the server is started and stopped on its own, and how
+// long it can stay empty before it is stopped.
+type mcSchedule struct {
+	windows  []scheduleWindow
+	location *time.Location
+	// Zero to never stop the server for being empty.
+	idle time.Duration
+}
+
+var hcSchedule = mcSchedule{location: time.Local}
+
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, it should look like 18:30", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// parseSchedule parses a comma separated list of windows like 18:00-23:30.
+func parseSchedule(schedule string) ([]scheduleWindow, error) {
+	var windows []scheduleWindow
+	for window := range strings.SplitSeq(schedule, ",") {
+		if strings.TrimSpace(window) == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(window, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q, it should look like 18:00-23:30", window)
+		}
+		var w scheduleWindow
+		var err error
+		if w.start, err = parseClock(start); err != nil {
+			return nil, err
+		}
+		if w.end, err = parseClock(end); err != nil {
+			return nil, err
+		}
+		if w.start == w.end {
+			return nil, fmt.Errorf("window %q is empty", window)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// scheduled tells whether the server should be up at t.
+func (s mcSchedule) scheduled(t time.Time) bool {
+	t = t.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range s.windows {
+		if window.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// announcementChannel is where the server says it is starting or stopping on
+// its own: the channel it was last started from. The mutex must be held.
+func (s *gameServer) announcementChannel() string {
+	if s.record.Channel != "" {
+		return s.record.Channel
+	}
+	return s.config.StatusChannel
+}
+
+// idle tells whether nobody has been playing for as long as the schedule
+// allows, keeping track of when the server emptied. The mutex must be held.
+func (s *gameServer) idle(schedule mcSchedule, now time.Time) bool {
+	if schedule.idle == 0 || s.record.State != serverRunning {
+		s.emptySince = time.Time{}
+		return false
+	}
+	health := s.ping()
+	if health == nil || health.minecraft == nil {
+		// Still starting, or not answering: better not to count it as empty.
+		return false
+	}
+	if health.minecraft.Players.Online > 0 {
+		s.emptySince = time.Time{}
+		return false
+	}
+	if s.emptySince.IsZero() {
+		s.emptySince = now
+	}
+	return now.Sub(s.emptySince) >= schedule.idle
+}
+
+// followSchedule starts the server when one of the windows of the schedule
+// begins and stops it when it ends, and stops it when it has been empty for
+// too long. Only the edges of the windows count, so that the server can still
+// be stopped in a window and started outside of them.
+func (s *gameServer) followSchedule(session *dgo.Session, schedule mcSchedule) func() error {
+	last := time.Now()
+	return func() error {
+		now := time.Now()
+		wasScheduled, isScheduled := schedule.scheduled(last), schedule.scheduled(now)
+		last = now
+
+		s.mutex.Lock()
+		state := s.record.State
+		channel := s.announcementChannel()
+		idle := s.idle(schedule, now)
+		s.mutex.Unlock()
+		if channel == "" {
+			return nil
+		}
+
+		switch {
+		case isScheduled && !wasScheduled && (state == serverStopped || state == serverCrashed):
+			session.ChannelMessageSend(channel, "Starting the server as scheduled.")
+			return s.start(session, channel)
+		case wasScheduled && !isScheduled && state == serverRunning:
+			session.ChannelMessageSend(channel, "The scheduled playtime is over.")
+			return s.stop(session, channel)
+		case idle:
+			session.ChannelMessageSend(
+				channel,
+				fmt.Sprintf("Nobody has played for %d minutes.", int(schedule.idle.Minutes())),
+			)
+			return s.stop(session, channel)
+		}
+		return nil
+	}
+}
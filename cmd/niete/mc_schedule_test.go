@@ -0,0 +1,59 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		want     []scheduleWindow
+		wantErr  bool
+	}{
+		{schedule: "", want: nil},
+		{schedule: "18:00-23:30", want: []scheduleWindow{{1080, 1410}}},
+		{schedule: " 22:00 - 02:00, 12:00-13:00 ,", want: []scheduleWindow{{1320, 120}, {720, 780}}},
+		{schedule: "18:00", wantErr: true},
+		{schedule: "18:00-25:00", wantErr: true},
+		{schedule: "6pm-11pm", wantErr: true},
+		{schedule: "18:00-18:00", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseSchedule(test.schedule)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseSchedule(%q) = %v, want an error", test.schedule, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("parseSchedule(%q) = %v, %v, want %v", test.schedule, got, err, test.want)
+		}
+	}
+}
+
+func TestScheduleWindowContains(t *testing.T) {
+	tests := []struct {
+		window scheduleWindow
+		minute int
+		want   bool
+	}{
+		{window: scheduleWindow{1080, 1410}, minute: 1080, want: true},
+		{window: scheduleWindow{1080, 1410}, minute: 1409, want: true},
+		{window: scheduleWindow{1080, 1410}, minute: 1410, want: false},
+		{window: scheduleWindow{1080, 1410}, minute: 60, want: false},
+		// 22:00-02:00
+		{window: scheduleWindow{1320, 120}, minute: 1320, want: true},
+		{window: scheduleWindow{1320, 120}, minute: 1439, want: true},
+		{window: scheduleWindow{1320, 120}, minute: 0, want: true},
+		{window: scheduleWindow{1320, 120}, minute: 119, want: true},
+		{window: scheduleWindow{1320, 120}, minute: 120, want: false},
+		{window: scheduleWindow{1320, 120}, minute: 720, want: false},
+	}
+	for _, test := range tests {
+		if got := test.window.contains(test.minute); got != test.want {
+			t.Errorf("%s contains %d = %v, want %v", test.window, test.minute, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultTranslationEmoji = "🇬🇧"
+	// Minutes of inactivity before Discord archives the translation threads.
+	translationThreadArchive = 60
+)
+
+type translatedMessage struct {
+	MessageId string    `bson:"messageId"`
+	ChannelId string    `bson:"channelId"`
+	UserId    string    `bson:"userId"`
+	Date      time.Time `bson:"date"`
+}
+
+// parseEmoji turns an emoji as typed in a message, <:name:id> for custom
+// ones, into the name:id form reactions come with.
+func parseEmoji(emoji string) string {
+	emoji = strings.TrimSuffix(strings.TrimPrefix(emoji, "<"), ">")
+	emoji = strings.TrimPrefix(emoji, "a:")
+	return strings.TrimPrefix(emoji, ":")
+}
+
+func setupTranslatedMessages() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("translatedMessages").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"messageId": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// markTranslated records that a message is being translated. It returns false
+// if it already was.
+func markTranslated(r *dgo.MessageReactionAdd) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("translatedMessages").InsertOne(ctx, translatedMessage{
+		MessageId: r.MessageID,
+		ChannelId: r.ChannelID,
+		UserId:    r.UserID,
+		Date:      time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unmarkTranslated lets a message be translated again after a failure.
+func unmarkTranslated(messageId string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := getDatabase().Collection("translatedMessages").DeleteOne(ctx, bson.M{"messageId": messageId}); err != nil {
+		logger.Printf("Could not unmark message %s as translated: %v\n", messageId, err)
+	}
+}
+
+// messageTranslationEmbeds translates the tweets a message links or, if it
+// links none, its text.
+func messageTranslationEmbeds(m *dgo.Message, guild string, policy *translationPolicy) ([]*dgo.MessageEmbed, error) {
+	terms, err := getGlossary(guild)
+	if err != nil {
+		logger.Printf("Could not get the glossary of guild %s: %v\n", guild, err)
+	}
+	var embeds []*dgo.MessageEmbed
+	urls := tweetURLRegex.FindAllString(m.Content, -1)
+	for _, URL := range urls {
+		id, _ := tweetId(URL)
+		cached, err := translateTweet(id, URL, policy, terms)
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil {
+			embeds = append(embeds, tweetEmbed(cached.Tweet, cached.Original, cached.Translation))
+		}
+	}
+	if len(urls) > 0 {
+		return embeds, nil
+	}
+
+	text := messageText(m)
+	if text == "" {
+		return nil, nil
+	}
+	result, err := translateWithGlossary(text, terms, policy.options())
+	if err != nil {
+		return nil, err
+	}
+	if sameLanguage(result.SourceLanguage, policy.TargetLanguage) || !policy.allows(result.SourceLanguage) {
+		return nil, nil
+	}
+	return []*dgo.MessageEmbed{translationEmbed(result, policy.TargetLanguage)}, nil
+}
+
+// translationThread returns the channel the translation of a message goes to:
+// a thread started from the message, or the channel itself if that is not
+// possible.
+func translationThread(session *dgo.Session, m *dgo.Message) string {
+	if m.Thread != nil {
+		return m.Thread.ID
+	}
+	channel, err := session.State.Channel(m.ChannelID)
+	if err != nil {
+		channel, err = session.Channel(m.ChannelID)
+	}
+	if err != nil || channel.IsThread() || channel.Type == dgo.ChannelTypeDM {
+		return m.ChannelID
+	}
+	thread, err := session.MessageThreadStartComplex(m.ChannelID, m.ID, &dgo.ThreadStart{
+		Name:                "Translation",
+		AutoArchiveDuration: translationThreadArchive,
+	})
+	if err != nil {
+		logger.Printf("Could not start a thread on message %s: %v\n", m.ID, err)
+		return m.ChannelID
+	}
+	return thread.ID
+}
+
+// reactionHandler translates a message when someone reacts to it with the
+// emoji of the channel, in the channels that translate on reactions.
+func reactionHandler(session *dgo.Session, r *dgo.MessageReactionAdd) {
+	if r.UserID == session.State.User.ID {
+		return
+	}
+	if err := translateOnReaction(session, r); err != nil {
+		logger.Printf("Error translating message %s on a reaction: %v\n", r.MessageID, err)
+	}
+}
+
+func translateOnReaction(session *dgo.Session, r *dgo.MessageReactionAdd) error {
+	policy, err := getTranslationPolicy(session, r.GuildID, r.ChannelID)
+	if err != nil {
+		return err
+	}
+	if policy.Mode != translationReaction || r.Emoji.APIName() != policy.emoji() {
+		return nil
+	}
+	first, err := markTranslated(r)
+	if err != nil || !first {
+		return err
+	}
+
+	m, err := session.ChannelMessage(r.ChannelID, r.MessageID)
+	if err != nil {
+		unmarkTranslated(r.MessageID)
+		return err
+	}
+	embeds, err := messageTranslationEmbeds(m, r.GuildID, policy)
+	if err != nil {
+		unmarkTranslated(r.MessageID)
+		return err
+	}
+	if len(embeds) == 0 {
+		return nil
+	}
+
+	channel := translationThread(session, m)
+	for n, batch := range embedMessages(embeds) {
+		send := &dgo.MessageSend{Embeds: batch, AllowedMentions: &dgo.MessageAllowedMentions{}}
+		if n == 0 && channel == m.ChannelID {
+			send.Reference = m.SoftReference()
+		}
+		if _, err = session.ChannelMessageSendComplex(channel, send); err != nil {
+			// Unless part of it is out already, it can be tried again.
+			if n == 0 {
+				unmarkTranslated(r.MessageID)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+func TestParseEmoji(t *testing.T) {
+	tests := []struct {
+		typed string
+		// The emoji of the reaction that should match it.
+		reaction dgo.Emoji
+	}{
+		{"🇬🇧", dgo.Emoji{Name: "🇬🇧"}},
+		{"<:translate:123456>", dgo.Emoji{Name: "translate", ID: "123456"}},
+		{"<a:spinning:123456>", dgo.Emoji{Name: "spinning", ID: "123456", Animated: true}},
+		{"translate:123456", dgo.Emoji{Name: "translate", ID: "123456"}},
+	}
+	for _, test := range tests {
+		if got, want := parseEmoji(test.typed), test.reaction.APIName(); got != want {
+			t.Errorf("parseEmoji(%q) = %q, want %q", test.typed, got, want)
+		}
+	}
+}
+
+func TestPolicyEmoji(t *testing.T) {
+	policy := &translationPolicy{Mode: translationReaction}
+	if got := policy.emoji(); got != defaultTranslationEmoji {
+		t.Errorf("the emoji of a new policy is %q", got)
+	}
+	policy.Emoji = parseEmoji("<:translate:123456>")
+	if got := policy.emoji(); got != "translate:123456" {
+		t.Errorf("the emoji is %q", got)
+	}
+}
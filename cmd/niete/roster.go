@@ -0,0 +1,530 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A sync that would remove more than this many members, and more than a third
+// of the crew, is more likely an outage of gbfdata than a mass exodus.
+const maxRosterDepartures = 3
+
+var errRosterShrank = errors.New("the member list shrank too much")
+
+type accountLink struct {
+	DiscordId string    `bson:"discordId"`
+	GBFUserId uint64    `bson:"gbfUserId"`
+	Linked    time.Time `bson:"linked"`
+}
+
+type rosterMember struct {
+	CrewId   string    `bson:"crewId"`
+	UserId   uint64    `bson:"userId"`
+	Name     string    `bson:"name"`
+	Position uint      `bson:"position"`
+	Joined   time.Time `bson:"joined"`
+	LastSeen time.Time `bson:"lastSeen"`
+}
+
+type crewSettings struct {
+	CrewId        string `bson:"crewId"`
+	RosterChannel string `bson:"rosterChannel"`
+}
+
+// linkRequest is a link waiting for an officer to approve it, so that nobody
+// can claim the GBF account of somebody else.
+type linkRequest struct {
+	DiscordId string    `bson:"discordId"`
+	GBFUserId uint64    `bson:"gbfUserId"`
+	Requested time.Time `bson:"requested"`
+}
+
+// mentionedUserId returns the ID of the Discord user mentioned in arg, which
+// can also be the bare ID.
+func mentionedUserId(arg string) (string, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(arg, "<@"), "!"), ">")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+func linkHandler(session *dgo.Session, channel, discordId string, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if len(args) == 0 {
+		link := &accountLink{}
+		err := getDatabase().Collection("accountLinks").FindOne(ctx, bson.M{"discordId": discordId}).Decode(link)
+		if err == nil {
+			_, err = session.ChannelMessageSend(channel, fmt.Sprintf("You are linked to the GBF user `%d`.", link.GBFUserId))
+			return err
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+		request := &linkRequest{}
+		err = getDatabase().Collection("linkRequests").FindOne(ctx, bson.M{"discordId": discordId}).Decode(request)
+		if err == nil {
+			_, err = session.ChannelMessageSend(
+				channel,
+				fmt.Sprintf("Your link to the GBF user `%d` is waiting for an officer to approve it.", request.GBFUserId),
+			)
+			return err
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+		_, err = session.ChannelMessageSend(channel, "Your account is not linked. Use `$link <gbf user id>`.")
+		return err
+	}
+	if args[0] == "approve" {
+		return approveLink(session, channel, discordId, args[1:])
+	}
+	gbfUserId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		_, err = session.ChannelMessageSend(channel, "Please input your GBF user ID.")
+		return err
+	}
+	if isAdmin(session, channel, discordId) {
+		return storeLink(session, channel, discordId, gbfUserId, "you")
+	}
+	_, err = getDatabase().Collection("linkRequests").ReplaceOne(
+		ctx,
+		bson.M{"discordId": discordId},
+		linkRequest{DiscordId: discordId, GBFUserId: gbfUserId, Requested: time.Now()},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = session.ChannelMessageSend(
+		channel,
+		fmt.Sprintf("An officer has to approve the link to the GBF user `%d` with `$link approve <@%s>`.", gbfUserId, discordId),
+	)
+	return err
+}
+
+// approveLink stores the link requested by the mentioned user. Only admins can
+// approve links.
+func approveLink(session *dgo.Session, channel, approver string, args []string) error {
+	if !isAdmin(session, channel, approver) {
+		_, err := session.ChannelMessageSend(channel, "Only officers can approve links.")
+		return err
+	}
+	if len(args) != 1 {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$link approve <@user>`")
+		return err
+	}
+	discordId, ok := mentionedUserId(args[0])
+	if !ok {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$link approve <@user>`")
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request := &linkRequest{}
+	err := getDatabase().Collection("linkRequests").FindOne(ctx, bson.M{"discordId": discordId}).Decode(request)
+	if err == mongo.ErrNoDocuments {
+		_, err = session.ChannelMessageSend(channel, "That user has not asked to link their account.")
+		return err
+	}
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	if err = storeLink(session, channel, discordId, request.GBFUserId, "<@"+discordId+">"); err != nil {
+		return err
+	}
+	_, err = getDatabase().Collection("linkRequests").DeleteOne(ctx, bson.M{"discordId": discordId})
+	return err
+}
+
+// storeLink links a Discord user to a GBF user, unless somebody else is
+// already linked to it. who is how the Discord user is called in the reply.
+func storeLink(session *dgo.Session, channel, discordId string, gbfUserId uint64, who string) error {
+	collection := getDatabase().Collection("accountLinks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	alreadyLinked := fmt.Sprintf("The GBF user `%d` is already linked to someone else. They have to `$unlink` first.", gbfUserId)
+	err := collection.FindOne(ctx, bson.M{"gbfUserId": gbfUserId, "discordId": bson.M{"$ne": discordId}}).Err()
+	if err == nil {
+		_, err = session.ChannelMessageSend(channel, alreadyLinked)
+		return err
+	}
+	if err != mongo.ErrNoDocuments {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = collection.UpdateOne(
+		ctx,
+		bson.M{"discordId": discordId},
+		bson.M{"$set": bson.M{"gbfUserId": gbfUserId, "linked": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	// Someone else linked it in the meantime.
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = session.ChannelMessageSend(channel, alreadyLinked)
+		return err
+	}
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	reply := fmt.Sprintf("Linked %s to the GBF user `%d`.", who, gbfUserId)
+	member := &rosterMember{}
+	err = getDatabase().Collection("roster").FindOne(ctx, bson.M{"userId": gbfUserId}).Decode(member)
+	if err == nil {
+		reply = fmt.Sprintf("Linked %s to %s.", who, member.Name)
+	}
+	_, err = session.ChannelMessageSend(channel, reply)
+	return err
+}
+
+func unlinkHandler(session *dgo.Session, channel, discordId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("accountLinks").DeleteOne(ctx, bson.M{"discordId": discordId})
+	if err != nil {
+		return err
+	}
+	_, err = getDatabase().Collection("linkRequests").DeleteOne(ctx, bson.M{"discordId": discordId})
+	if err != nil {
+		return err
+	}
+	_, err = session.ChannelMessageSend(channel, "Your account is no longer linked.")
+	return err
+}
+
+// setupAccountLinks makes sure that every GBF user is linked to one Discord
+// user at most.
+func setupAccountLinks() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("accountLinks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"gbfUserId": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// getLinkedDiscordIds maps GBF user IDs to the Discord users linked to them.
+func getLinkedDiscordIds(userIds []uint64) (map[uint64]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := getDatabase().Collection("accountLinks").Find(ctx, bson.M{"gbfUserId": bson.M{"$in": userIds}})
+	if err != nil {
+		return nil, err
+	}
+	var links []accountLink
+	if err = cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	discordIds := make(map[uint64]string)
+	for _, link := range links {
+		discordIds[link.GBFUserId] = link.DiscordId
+	}
+	return discordIds, nil
+}
+
+// memberMention mentions the Discord user linked to a member, or just writes
+// their name if there is none.
+func memberMention(name string, userId uint64, discordIds map[uint64]string) string {
+	if discordId, ok := discordIds[userId]; ok {
+		return "<@" + discordId + ">"
+	}
+	return name
+}
+
+func getCrewSettings(crewId string) (*crewSettings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	settings := &crewSettings{CrewId: crewId}
+	err := getDatabase().Collection("crewSettings").FindOne(ctx, bson.M{"crewId": crewId}).Decode(settings)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// syncRoster updates the stored roster of the crew with its current members
+// and returns who joined and who left since the last sync. The first sync of
+// a crew does not report anybody as a joiner. Unless force is set, nothing is
+// synced if the crew seems to have lost too many members at once.
+func syncRoster(crewId string, force bool) ([]rosterMember, []rosterMember, error) {
+	members, err := getCrewGWMembers(crewId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil, errors.New("the member list is empty")
+	}
+	collection := getDatabase().Collection("roster")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := collection.Find(ctx, bson.M{"crewId": crewId})
+	if err != nil {
+		return nil, nil, err
+	}
+	var stored []rosterMember
+	if err = cursor.All(ctx, &stored); err != nil {
+		return nil, nil, err
+	}
+	known := make(map[uint64]bool)
+	for _, member := range stored {
+		known[member.UserId] = true
+	}
+	current := make(map[uint64]bool)
+	for _, member := range members {
+		current[member.UserId] = true
+	}
+	departures := countDepartures(stored, current)
+	if !force && departures > maxRosterDepartures && departures*3 > len(stored) {
+		return nil, nil, fmt.Errorf("%w, %d of %d members left", errRosterShrank, departures, len(stored))
+	}
+
+	now := time.Now()
+	var joined, left []rosterMember
+	for _, member := range members {
+		rosterEntry := rosterMember{
+			CrewId:   crewId,
+			UserId:   member.UserId,
+			Name:     member.Name,
+			Position: member.MemberPosition,
+			Joined:   now,
+			LastSeen: now,
+		}
+		if !known[member.UserId] && len(stored) > 0 {
+			joined = append(joined, rosterEntry)
+		}
+		_, err = collection.UpdateOne(
+			ctx,
+			bson.M{"crewId": crewId, "userId": member.UserId},
+			bson.M{
+				"$set":         bson.M{"name": member.Name, "position": member.MemberPosition, "lastSeen": now},
+				"$setOnInsert": bson.M{"joined": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, member := range stored {
+		if current[member.UserId] {
+			continue
+		}
+		left = append(left, member)
+		_, err = collection.DeleteOne(ctx, bson.M{"crewId": crewId, "userId": member.UserId})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return joined, left, nil
+}
+
+// countDepartures counts the stored members that are no longer in the crew.
+// Members leaving while others join do not change the size of the crew, so
+// they are counted one by one.
+func countDepartures(stored []rosterMember, current map[uint64]bool) int {
+	departures := 0
+	for _, member := range stored {
+		if !current[member.UserId] {
+			departures++
+		}
+	}
+	return departures
+}
+
+func announceRosterChanges(session *dgo.Session, channel string, joined, left []rosterMember) error {
+	if len(joined) == 0 && len(left) == 0 {
+		return nil
+	}
+	userIds := make([]uint64, 0, len(joined)+len(left))
+	for _, member := range append(joined, left...) {
+		userIds = append(userIds, member.UserId)
+	}
+	discordIds, err := getLinkedDiscordIds(userIds)
+	if err != nil {
+		return err
+	}
+	message := ""
+	for _, member := range joined {
+		message += fmt.Sprintf(":wave: %s joined the crew!\n", memberMention(member.Name, member.UserId, discordIds))
+	}
+	for _, member := range left {
+		message += fmt.Sprintf(":door: %s left the crew.\n", memberMention(member.Name, member.UserId, discordIds))
+	}
+	_, err = session.ChannelMessageSend(channel, message)
+	return err
+}
+
+// syncRosterJob syncs the roster of the crew and announces the changes in its
+// roster channel, if there is one.
+func syncRosterJob(session *dgo.Session, crewId string) error {
+	if crewId == "" {
+		return nil
+	}
+	joined, left, err := syncRoster(crewId, false)
+	if err != nil {
+		return err
+	}
+	settings, err := getCrewSettings(crewId)
+	if err != nil || settings.RosterChannel == "" {
+		return err
+	}
+	return announceRosterChanges(session, settings.RosterChannel, joined, left)
+}
+
+// syncRosterJobs syncs the rosters of every configured crew.
+func syncRosterJobs(session *dgo.Session) error {
+	crews, err := allConfiguredCrews()
+	if err != nil {
+		return err
+	}
+	for _, crewId := range crews {
+		if err = syncRosterJob(session, crewId); err != nil {
+			logger.Printf("Could not sync the roster of crew %s: %v\n", crewId, err)
+		}
+	}
+	return nil
+}
+
+func sendRoster(session *dgo.Session, channel, crewId string) error {
+	members, err := getCrewGWMembers(crewId)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong when retrieving the data.")
+		return err
+	}
+	userIds := make([]uint64, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	discordIds, err := getLinkedDiscordIds(userIds)
+	if err != nil {
+		return err
+	}
+
+	pulls := make(map[string]int64)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	linked := make([]string, 0, len(discordIds))
+	for _, discordId := range discordIds {
+		linked = append(linked, discordId)
+	}
+	cursor, err := getDatabase().Collection("players").Find(ctx, bson.M{"discordId": bson.M{"$in": linked}})
+	if err != nil {
+		return err
+	}
+	var playersData []map[string]any
+	if err = cursor.All(ctx, &playersData); err != nil {
+		return err
+	}
+	for _, playerData := range playersData {
+		pulls[playerData["discordId"].(string)] = getTotalPulls(playerData)
+	}
+
+	table := newTextTable(
+		tableColumn{Header: "Player", MaxWidth: 15},
+		tableColumn{Header: "Linked"},
+		tableColumn{Header: "GW honors", AlignRight: true},
+		tableColumn{Header: "Pulls", AlignRight: true},
+	)
+	for _, member := range filterAndSortPlayers(members, shameOptions{sortBy: "honors"}) {
+		discordId, isLinked := discordIds[member.UserId]
+		linkedCell, pullsCell := "", "-"
+		if isLinked {
+			linkedCell = "yes"
+			if memberPulls, ok := pulls[discordId]; ok {
+				pullsCell = intComma(int(memberPulls))
+			}
+		}
+		table.addRow(member.Name, linkedCell, intComma(int(memberPoints(member))), pullsCell)
+	}
+	footer := fmt.Sprintf("%d/%d members linked their Discord account with `$link`.", len(discordIds), len(members))
+	return sendTable(session, channel, "Roster", "", footer, table)
+}
+
+func rosterHandler(session *dgo.Session, channel, crewId string, args []string) error {
+	if crewId == "" {
+		_, err := session.ChannelMessageSend(channel, "There is no crew configured. Use `$crew set <crew id>`.")
+		return err
+	}
+	if len(args) == 0 {
+		return sendRoster(session, channel, crewId)
+	}
+	switch args[0] {
+	case "sync":
+		joined, left, err := syncRoster(crewId, len(args) > 1 && args[1] == "force")
+		if errors.Is(err, errRosterShrank) {
+			_, err = session.ChannelMessageSend(
+				channel,
+				"Too many members seem to have left at once, gbfdata may be having issues. Use `$roster sync force` if they really did.",
+			)
+			return err
+		}
+		if err != nil {
+			session.ChannelMessageSend(channel, "Sorry, something went wrong when retrieving the data.")
+			return err
+		}
+		if len(joined) == 0 && len(left) == 0 {
+			_, err = session.ChannelMessageSend(channel, "The roster is up to date.")
+			return err
+		}
+		return announceRosterChanges(session, channel, joined, left)
+	case "announce":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := getDatabase().Collection("crewSettings").UpdateOne(
+			ctx,
+			bson.M{"crewId": crewId},
+			bson.M{"$set": bson.M{"rosterChannel": channel}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+		_, err = session.ChannelMessageSend(channel, "Members joining and leaving the crew will be announced here.")
+		return err
+	default:
+		_, err := session.ChannelMessageSend(channel, "Usage: `$roster [sync [force]|announce]`")
+		return err
+	}
+}
+
+// shortfallMentions lists the members linked to a Discord account that did not
+// meet the quota, so that they get pinged.
+func shortfallMentions(contributions []memberContribution, quota uint64) (string, error) {
+	userIds := make([]uint64, 0, len(contributions))
+	for _, contribution := range contributions {
+		if contribution.Honors < quota {
+			userIds = append(userIds, contribution.UserId)
+		}
+	}
+	if len(userIds) == 0 {
+		return "", nil
+	}
+	discordIds, err := getLinkedDiscordIds(userIds)
+	if err != nil {
+		return "", err
+	}
+	var mentions []string
+	for _, contribution := range contributions {
+		if discordId, ok := discordIds[contribution.UserId]; ok && contribution.Honors < quota {
+			mentions = append(mentions, fmt.Sprintf("<@%s> (-%s)", discordId, intComma(int(quota-contribution.Honors))))
+		}
+	}
+	if len(mentions) == 0 {
+		return "", nil
+	}
+	return "Fell short: " + strings.Join(mentions, ", "), nil
+}
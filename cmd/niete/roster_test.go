@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestCountDepartures(t *testing.T) {
+	stored := []rosterMember{{UserId: 1}, {UserId: 2}, {UserId: 3}}
+	tests := []struct {
+		name    string
+		current []uint64
+		want    int
+	}{
+		{name: "nobody left", current: []uint64{1, 2, 3}, want: 0},
+		{name: "someone joined", current: []uint64{1, 2, 3, 4}, want: 0},
+		{name: "someone left", current: []uint64{1, 3}, want: 1},
+		{name: "as many left as joined", current: []uint64{1, 4, 5}, want: 2},
+		{name: "everybody left", current: nil, want: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := make(map[uint64]bool)
+			for _, id := range test.current {
+				current[id] = true
+			}
+			if got := countDepartures(stored, current); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMentionedUserId(t *testing.T) {
+	tests := []struct {
+		arg    string
+		want   string
+		wantOk bool
+	}{
+		{arg: "<@123456789>", want: "123456789", wantOk: true},
+		{arg: "<@!123456789>", want: "123456789", wantOk: true},
+		{arg: "123456789", want: "123456789", wantOk: true},
+		{arg: "<@&123456789>"},
+		{arg: "@someone"},
+		{arg: ""},
+	}
+	for _, test := range tests {
+		got, ok := mentionedUserId(test.arg)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("mentionedUserId(%q) = %q, %v, want %q, %v", test.arg, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestMemberMention(t *testing.T) {
+	discordIds := map[uint64]string{1: "111"}
+	if got := memberMention("Gran", 1, discordIds); got != "<@111>" {
+		t.Errorf("linked member mentioned as %q", got)
+	}
+	if got := memberMention("Djeeta", 2, discordIds); got != "Djeeta" {
+		t.Errorf("member without a link mentioned as %q", got)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// runEvery runs job in the background every interval for as long as the bot
+// is up. Errors are logged and the job keeps being scheduled.
+func runEvery(name string, interval time.Duration, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := runJob(job); err != nil {
+				logger.Printf("Scheduled job %s failed: %v\n", name, err)
+			}
+		}
+	}()
+}
+
+// runJob runs job once, turning a panic into an error so that a page with an
+// unexpected layout does not bring the whole bot down.
+func runJob(job func() error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return job()
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+const defaultServersConfig = "servers.json"
+
+// Health checks a server can have.
+const (
+	// Server List Ping, which also tells the version and the players.
+	healthCheckMinecraft = "minecraft"
+	// Whether something accepts connections on the port.
+	healthCheckTCP  = "tcp"
+	healthCheckNone = "none"
+)
+
+// serverConfig is a game server as declared in SERVERS_CONFIG.
+type serverConfig struct {
+	Name string `json:"name"`
+	// The program and its arguments.
+	Command []string `json:"command"`
+	Dir     string   `json:"dir"`
+	// Sent to the process group of the server to stop it. SIGINT by default.
+	StopSignal  string `json:"stopSignal"`
+	Port        int    `json:"port"`
+	HealthCheck string `json:"healthCheck"`
+	// ngrok, static, fake or none, the default.
+	Tunnel string `json:"tunnel"`
+	// The public address of the server with the static tunnel.
+	Address string `json:"address"`
+	// The local API of the ngrok of the server, NGROK_API_URL by default.
+	// Each ngrok running at the same time has its own.
+	NgrokAPI string `json:"ngrokApi"`
+	// The channel of its pinned status message. The channel it was last
+	// started from by default.
+	StatusChannel string `json:"statusChannel"`
+	// Where its output is logged. <name>.log by default.
+	Log string `json:"log"`
+}
+
+var (
+	servers     = map[string]*gameServer{}
+	stopSignals = map[string]syscall.Signal{
+		"SIGINT":  syscall.SIGINT,
+		"SIGTERM": syscall.SIGTERM,
+		"SIGQUIT": syscall.SIGQUIT,
+		"SIGHUP":  syscall.SIGHUP,
+		"SIGKILL": syscall.SIGKILL,
+	}
+)
+
+// loadServerConfigs reads the servers declared in path. A missing file means
+// there are none.
+func loadServerConfigs(path string) ([]serverConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var configs []serverConfig
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("%s is not valid: %w", path, err)
+	}
+	return configs, nil
+}
+
+func newGameServer(config serverConfig) (*gameServer, error) {
+	if config.Name == "" || strings.ContainsAny(config.Name, " \t\n") {
+		return nil, fmt.Errorf("invalid server name %q", config.Name)
+	}
+	if len(config.Command) == 0 {
+		return nil, fmt.Errorf("server %s has no command", config.Name)
+	}
+	if config.StopSignal == "" {
+		config.StopSignal = "SIGINT"
+	}
+	stopSignal, ok := stopSignals[strings.ToUpper(config.StopSignal)]
+	if !ok {
+		return nil, fmt.Errorf("server %s has an unknown stop signal %q", config.Name, config.StopSignal)
+	}
+	if config.HealthCheck == "" {
+		config.HealthCheck = healthCheckTCP
+		if config.Port == 0 {
+			config.HealthCheck = healthCheckNone
+		}
+	}
+	switch config.HealthCheck {
+	case healthCheckMinecraft, healthCheckTCP:
+		if config.Port == 0 {
+			return nil, fmt.Errorf("server %s needs a port for its health check", config.Name)
+		}
+	case healthCheckNone:
+	default:
+		return nil, fmt.Errorf("server %s has an unknown health check %q", config.Name, config.HealthCheck)
+	}
+	t, err := newTunnel(config.Tunnel, config.Address, config.NgrokAPI)
+	if err != nil {
+		return nil, fmt.Errorf("server %s: %w", config.Name, err)
+	}
+	if config.Log == "" {
+		config.Log = config.Name + ".log"
+	}
+	return &gameServer{
+		config:     config,
+		stopSignal: stopSignal,
+		tunnel:     t,
+		records:    mongoServerRecords{},
+		record:     serverRecord{Name: config.Name, State: serverStopped},
+		logFile:    &rotatingFile{path: config.Log, maxSize: mcLogMaxSize, backups: mcLogBackups},
+	}, nil
+}
+
+// setupServers creates the servers declared in SERVERS_CONFIG. The HC server
+// is configured with its environment variables unless it is declared there,
+// and there is none if MC_DIR_PATH is not set either.
+func setupServers(path string) error {
+	configs, err := loadServerConfigs(path)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(configs, func(config serverConfig) bool { return config.Name == "hc" }) {
+		if config, ok := hcConfig(); ok {
+			configs = append(configs, config)
+		}
+	}
+	for _, config := range configs {
+		if servers[config.Name] != nil {
+			return fmt.Errorf("server %s is declared twice", config.Name)
+		}
+		server, err := newGameServer(config)
+		if err != nil {
+			return err
+		}
+		servers[config.Name] = server
+	}
+	// The output of the HC server is also relayed to HC_LOG_CHANNEL.
+	if hc = servers["hc"]; hc != nil {
+		hcLogs.file = hc.logFile
+		hc.logs = hcLogs
+	}
+	return nil
+}
+
+// hcConfig is the HC server as configured by MC_DIR_PATH and the HC_
+// environment variables. It returns false if MC_DIR_PATH is not set.
+func hcConfig() (serverConfig, bool) {
+	config := serverConfig{
+		Name:          "hc",
+		Command:       []string{"python3", "quick.py"},
+		StopSignal:    "SIGINT",
+		Port:          hcPort,
+		HealthCheck:   healthCheckMinecraft,
+		Tunnel:        "ngrok",
+		StatusChannel: hcStatusChannel,
+		Log:           hcLogPath,
+	}
+	if err := getToken(&config.Dir, "MC_DIR_PATH"); err != nil {
+		return config, false
+	}
+	getToken(&config.Tunnel, "HC_TUNNEL")
+	getToken(&config.Address, "HC_ADDRESS")
+	return config, true
+}
+
+// sortedServers returns the servers sorted by name.
+func sortedServers() []*gameServer {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	sorted := make([]*gameServer, len(names))
+	for i, name := range names {
+		sorted[i] = servers[name]
+	}
+	return sorted
+}
+
+func sendServers(session *dgo.Session, channel string) error {
+	var list strings.Builder
+	list.WriteString("Servers:\n")
+	for _, server := range sortedServers() {
+		server.mutex.Lock()
+		fmt.Fprintf(&list, "%s `%s`: %s\n", serverStateIcons[server.record.State], server.config.Name, server.record.State)
+		server.mutex.Unlock()
+	}
+	_, err := session.ChannelMessageSend(channel, list.String())
+	return err
+}
+
+// serverHandler handles $server, which starts, stops and shows the state of
+// the declared servers. text is everything after $server.
+func serverHandler(session *dgo.Session, channel string, text string) error {
+	args := strings.Fields(text)
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		return sendServers(session, channel)
+	}
+	if len(args) != 2 || !slices.Contains([]string{"start", "stop", "status"}, args[0]) {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$server [list|start <name>|stop <name>|status <name>]`")
+		return err
+	}
+	server := servers[args[1]]
+	if server == nil {
+		_, err := session.ChannelMessageSend(channel, fmt.Sprintf("There is no server called `%s`.", args[1]))
+		return err
+	}
+	switch args[0] {
+	case "start":
+		return server.start(session, channel)
+	case "stop":
+		return server.stop(session, channel)
+	}
+	return server.sendStatus(session, channel)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetupServersWithoutHC(t *testing.T) {
+	t.Cleanup(func() { servers, hc = map[string]*gameServer{}, nil })
+	t.Setenv("HC_TUNNEL", "fake")
+	t.Setenv("MC_DIR_PATH", "")
+	os.Unsetenv("MC_DIR_PATH")
+	path := filepath.Join(t.TempDir(), "servers.json")
+	err := os.WriteFile(path, []byte(`[{"name": "factorio", "command": ["sleep", "60"]}]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = setupServers(path); err != nil {
+		t.Fatal(err)
+	}
+	if hc != nil || len(servers) != 1 {
+		t.Errorf("got the servers %v and hc %v without MC_DIR_PATH", servers, hc)
+	}
+	if hc.running() {
+		t.Error("the missing HC server is running")
+	}
+
+	servers = map[string]*gameServer{}
+	t.Setenv("MC_DIR_PATH", t.TempDir())
+	if err = setupServers(path); err != nil {
+		t.Fatal(err)
+	}
+	if hc == nil || servers["hc"] != hc || hc.logs != hcLogs {
+		t.Errorf("got the servers %v and hc %v with MC_DIR_PATH", servers, hc)
+	}
+}
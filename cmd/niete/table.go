@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+const (
+	embedDescriptionLimit = 4096
+	messageContentLimit   = 2000
+	tableColumnSeparator  = "  "
+)
+
+type tableColumn struct {
+	Header string
+	// Cells wider than MaxWidth are truncated. Zero means no limit.
+	MaxWidth   int
+	AlignRight bool
+}
+
+// textTable renders rows as a monospace table inside code blocks. Widths are
+// measured in terminal cells, so East Asian names line up with the rest.
+type textTable struct {
+	columns []tableColumn
+	rows    [][]string
+}
+
+func newTextTable(columns ...tableColumn) *textTable {
+	return &textTable{columns: columns}
+}
+
+func (t *textTable) addRow(cells ...string) {
+	row := make([]string, len(t.columns))
+	copy(row, cells)
+	t.rows = append(t.rows, row)
+}
+
+func (t *textTable) widths() []int {
+	widths := make([]int, len(t.columns))
+	for i, column := range t.columns {
+		widths[i] = runewidth.StringWidth(column.Header)
+		for _, row := range t.rows {
+			widths[i] = max(widths[i], runewidth.StringWidth(row[i]))
+		}
+		if column.MaxWidth > 0 {
+			widths[i] = min(widths[i], column.MaxWidth)
+		}
+	}
+	return widths
+}
+
+func (t *textTable) formatRow(cells []string, widths []int) string {
+	formatted := make([]string, len(cells))
+	for i, cell := range cells {
+		cell = runewidth.Truncate(cell, widths[i], "…")
+		if t.columns[i].AlignRight {
+			formatted[i] = runewidth.FillLeft(cell, widths[i])
+		} else {
+			formatted[i] = runewidth.FillRight(cell, widths[i])
+		}
+	}
+	return strings.TrimRight(strings.Join(formatted, tableColumnSeparator), " ")
+}
+
+// render returns the table as code blocks no longer than limit bytes each.
+// Every block repeats the header line.
+func (t *textTable) render(limit int) []string {
+	widths := t.widths()
+	headers := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		headers[i] = column.Header
+	}
+	start := "```\n" + t.formatRow(headers, widths) + "\n"
+	end := "```"
+
+	var pages []string
+	page := start
+	for _, row := range t.rows {
+		line := t.formatRow(row, widths) + "\n"
+		if len(page)+len(line)+len(end) > limit && page != start {
+			pages = append(pages, page+end)
+			page = start
+		}
+		page += line
+	}
+	return append(pages, page+end)
+}
+
+// sendTable sends the table as one or more embeds. The header text goes
+// before the table in the first embed and the footer text after it in the
+// last one.
+func sendTable(session *dgo.Session, channel, title, header, footer string, table *textTable) error {
+	// A footer that would leave the table too little room, like a long list of
+	// mentions, is sent in messages of its own instead.
+	var separateFooter string
+	if len(header)+len(footer) > embedDescriptionLimit/2 {
+		separateFooter, footer = footer, ""
+	}
+	if header != "" {
+		header += "\n"
+	}
+	if footer != "" {
+		footer = "\n" + footer
+	}
+	pages := table.render(embedDescriptionLimit - len(header) - len(footer))
+	for n, page := range pages {
+		embed := &dgo.MessageEmbed{Title: title, Description: page}
+		if len(pages) > 1 && title != "" {
+			embed.Title = fmt.Sprintf("%s (%d/%d)", title, n+1, len(pages))
+		}
+		if n == 0 {
+			embed.Description = header + embed.Description
+		}
+		if n == len(pages)-1 {
+			embed.Description += footer
+		}
+		if _, err := session.ChannelMessageSendEmbed(channel, embed); err != nil {
+			return err
+		}
+	}
+	for _, message := range splitMessage(separateFooter, messageContentLimit) {
+		if _, err := session.ChannelMessageSend(channel, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMessage splits text into messages of at most limit characters,
+// between lines or, for lines longer than that, between words.
+func splitMessage(text string, limit int) []string {
+	var messages []string
+	message := ""
+	add := func(line string) {
+		if message != "" && utf8.RuneCountInString(message)+1+utf8.RuneCountInString(line) > limit {
+			messages = append(messages, message)
+			message = ""
+		}
+		if message != "" {
+			message += "\n"
+		}
+		message += line
+	}
+	for line := range strings.SplitSeq(text, "\n") {
+		for utf8.RuneCountInString(line) > limit {
+			runes := []rune(line)
+			cut := strings.LastIndex(string(runes[:limit+1]), " ")
+			if cut <= 0 {
+				cut = len(string(runes[:limit]))
+			}
+			add(line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		add(line)
+	}
+	if strings.TrimSpace(message) != "" {
+		messages = append(messages, message)
+	}
+	return messages
+}
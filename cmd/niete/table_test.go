@@ -0,0 +1,88 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTextTableRender(t *testing.T) {
+	newTable := func(nameWidth int) *textTable {
+		table := newTextTable(
+			tableColumn{Header: "Name", MaxWidth: nameWidth},
+			tableColumn{Header: "Honors", AlignRight: true},
+		)
+		table.addRow("ジータ", "1,000")
+		table.addRow("Lyria", "20")
+		return table
+	}
+	tests := []struct {
+		name      string
+		nameWidth int
+		limit     int
+		want      []string
+	}{
+		{
+			name:  "one page",
+			limit: 100,
+			want: []string{
+				"```\nName    Honors\nジータ   1,000\nLyria       20\n```",
+			},
+		},
+		{
+			name:  "a page per row",
+			limit: 40,
+			want: []string{
+				"```\nName    Honors\nジータ   1,000\n```",
+				"```\nName    Honors\nLyria       20\n```",
+			},
+		},
+		{
+			name:  "rows longer than the limit",
+			limit: 10,
+			want: []string{
+				"```\nName    Honors\nジータ   1,000\n```",
+				"```\nName    Honors\nLyria       20\n```",
+			},
+		},
+		{
+			name:      "truncated wide cells",
+			nameWidth: 4,
+			limit:     100,
+			want: []string{
+				"```\nName  Honors\nジ…    1,000\nLyr…      20\n```",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := newTable(test.nameWidth).render(test.limit)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{name: "empty", text: "", limit: 10},
+		{name: "fits", text: "one\ntwo", limit: 10, want: []string{"one\ntwo"}},
+		{name: "between lines", text: "one\ntwo\nthree", limit: 8, want: []string{"one\ntwo", "three"}},
+		{name: "long line", text: "one\nfour, five, six", limit: 10, want: []string{"one\nfour,", "five, six"}},
+		{name: "long word", text: "thirteenchars", limit: 8, want: []string{"thirteen", "chars"}},
+		{name: "wide characters", text: "ニーテ\nニーテ", limit: 7, want: []string{"ニーテ\nニーテ"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitMessage(test.text, test.limit)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
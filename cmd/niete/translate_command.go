@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultTargetLanguage = "EN"
+	// Images are read again at most once a day.
+	ocrCacheTTL  = 24 * time.Hour
+	ocrMaxImages = 3
+)
+
+// The target languages DeepL knows. The rest of the translators accept the
+// same codes, in lower case and without the variants.
+var targetLanguages = []string{
+	"AR", "BG", "CS", "DA", "DE", "EL", "EN", "EN-GB", "EN-US", "ES", "ET", "FI", "FR", "HU", "ID", "IT",
+	"JA", "KO", "LT", "LV", "NB", "NL", "PL", "PT", "PT-BR", "PT-PT", "RO", "RU", "SK", "SL", "SV", "TR",
+	"UK", "ZH", "ZH-HANS", "ZH-HANT",
+}
+
+var ocrSpaceKey string
+
+var applicationCommands = []*dgo.ApplicationCommand{
+	{Name: "Translate", Type: dgo.MessageApplicationCommand},
+}
+
+type userLanguage struct {
+	UserId   string `bson:"userId"`
+	Language string `bson:"language"`
+}
+
+func isTargetLanguage(code string) bool {
+	return slices.Contains(targetLanguages, strings.ToUpper(code))
+}
+
+// getUserLanguage returns the language the user wants translations in, English
+// unless they chose another one.
+func getUserLanguage(userId string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var language userLanguage
+	err := getDatabase().Collection("userLanguages").FindOne(ctx, bson.M{"userId": userId}).Decode(&language)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Printf("Could not get the language of %s: %v\n", userId, err)
+		}
+		return defaultTargetLanguage
+	}
+	return language.Language
+}
+
+func setUserLanguage(userId, language string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("userLanguages").ReplaceOne(
+		ctx,
+		bson.M{"userId": userId},
+		userLanguage{UserId: userId, Language: language},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// ocrImage reads the text in an image with OCR.space. It returns an empty
+// string if OCR_SPACE_KEY is not set.
+func ocrImage(imageURL string) (string, error) {
+	if ocrSpaceKey == "" {
+		return "", nil
+	}
+	form := url.Values{
+		"apikey":    {ocrSpaceKey},
+		"url":       {imageURL},
+		"language":  {"jpn"},
+		"OCREngine": {"2"},
+	}
+	body, err := web.fetch(outboundRequest{
+		Method: http.MethodPost,
+		URL:    "https://api.ocr.space/parse/image",
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:   []byte(form.Encode()),
+		TTL:    ocrCacheTTL,
+	})
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		ParsedResults []struct {
+			ParsedText string `json:"ParsedText"`
+		} `json:"ParsedResults"`
+		IsErroredOnProcessing bool `json:"IsErroredOnProcessing"`
+		ErrorMessage          any  `json:"ErrorMessage"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+	if response.IsErroredOnProcessing {
+		return "", fmt.Errorf("OCR.space could not read the image: %v", response.ErrorMessage)
+	}
+	var text []string
+	for _, result := range response.ParsedResults {
+		text = append(text, strings.TrimSpace(result.ParsedText))
+	}
+	return strings.Join(text, "\n"), nil
+}
+
+// messageText returns the text of a message, together with the text of its
+// embeds and of its first images.
+func messageText(m *dgo.Message) string {
+	text := strings.TrimSpace(m.Content)
+	for _, embed := range m.Embeds {
+		if embed.Description != "" {
+			text = strings.TrimSpace(text + "\n" + embed.Description)
+		}
+	}
+	images := 0
+	for _, attachment := range m.Attachments {
+		if !strings.HasPrefix(attachment.ContentType, "image/") || images == ocrMaxImages {
+			continue
+		}
+		images++
+		imageText, err := ocrImage(attachment.URL)
+		if err != nil {
+			logger.Printf("Could not read the text of %s: %v\n", attachment.URL, err)
+			continue
+		}
+		if imageText != "" {
+			text = strings.TrimSpace(text + "\n" + imageText)
+		}
+	}
+	return text
+}
+
+// translateText translates free text with the server's glossary.
+func translateText(text, guild, targetLanguage string) (*translation, error) {
+	terms, err := getGlossary(guild)
+	if err != nil {
+		logger.Printf("Could not get the glossary of guild %s: %v\n", guild, err)
+	}
+	return translateWithGlossary(text, terms, translationOptions{TargetLanguage: targetLanguage, Formality: "prefer_less"})
+}
+
+func translationEmbed(result *translation, targetLanguage string) *dgo.MessageEmbed {
+	return &dgo.MessageEmbed{
+		Description: truncateText(result.Text, embedDescriptionLimit),
+		Footer: &dgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Translated from %s to %s by %s", result.SourceLanguage, targetLanguage, result.Translator),
+		},
+	}
+}
+
+// leadingLanguage splits the language code a text to translate starts with
+// from the text. Only upper case codes count, so that texts starting with
+// words like "it" or "no" are not taken for Italian or Norwegian.
+func leadingLanguage(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	words := strings.Fields(text)
+	if len(words) < 2 || words[0] != strings.ToUpper(words[0]) || !isTargetLanguage(words[0]) {
+		return "", text
+	}
+	return words[0], strings.TrimSpace(strings.TrimPrefix(text, words[0]))
+}
+
+// translateHandler handles $translate [LANG] <text>, $translate lang [code] and
+// $translate stats. text is everything after the command, so that line breaks
+// are kept.
+func translateHandler(session *dgo.Session, m *dgo.Message, text string) error {
+	args := strings.Fields(text)
+	switch {
+	case len(args) == 0:
+		_, err := session.ChannelMessageSend(m.ChannelID, "Usage: `$translate [lang] <text>`, `$translate lang [code]` or `$translate stats`")
+		return err
+	case len(args) == 1 && args[0] == "stats":
+		return sendTranslationStats(session, m.ChannelID)
+	case args[0] == "lang" && len(args) <= 2:
+		if len(args) == 1 {
+			_, err := session.ChannelMessageSend(
+				m.ChannelID,
+				fmt.Sprintf("Your translations are in %s. Use `$translate lang <code>` to change it.", getUserLanguage(m.Author.ID)),
+			)
+			return err
+		}
+		if !isTargetLanguage(args[1]) {
+			_, err := session.ChannelMessageSend(
+				m.ChannelID,
+				fmt.Sprintf("Unknown language. Use one of %s.", strings.Join(targetLanguages, ", ")),
+			)
+			return err
+		}
+		language := strings.ToUpper(args[1])
+		if err := setUserLanguage(m.Author.ID, language); err != nil {
+			session.ChannelMessageSend(m.ChannelID, "Sorry, something went wrong.")
+			return err
+		}
+		_, err := session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Your translations will be in %s from now on.", language))
+		return err
+	}
+
+	targetLanguage, text := leadingLanguage(text)
+	if targetLanguage == "" {
+		targetLanguage = getUserLanguage(m.Author.ID)
+	}
+	if tweetURLRegex.MatchString(text) {
+		return translateTweetsOnRequest(session, m, targetLanguage)
+	}
+	result, err := translateText(text, m.GuildID, targetLanguage)
+	if err != nil {
+		session.ChannelMessageSend(m.ChannelID, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = session.ChannelMessageSendComplex(m.ChannelID, &dgo.MessageSend{
+		Embeds:          []*dgo.MessageEmbed{translationEmbed(result, targetLanguage)},
+		Reference:       m.SoftReference(),
+		AllowedMentions: &dgo.MessageAllowedMentions{},
+	})
+	return err
+}
+
+// translateTweetsOnRequest translates the tweets linked in a $translate
+// command, unless translations are off in the channel.
+func translateTweetsOnRequest(session *dgo.Session, m *dgo.Message, targetLanguage string) error {
+	policy, err := getTranslationPolicy(session, m.GuildID, m.ChannelID)
+	if err != nil {
+		session.ChannelMessageSend(m.ChannelID, "Sorry, something went wrong.")
+		return err
+	}
+	if policy.Mode == translationOff {
+		_, err = session.ChannelMessageSend(m.ChannelID, "Tweets are not translated in this channel.")
+		return err
+	}
+	policy.TargetLanguage = targetLanguage
+	// Whoever asked wants the translation, whatever the language of the tweet.
+	policy.SourceLanguages = nil
+	return translate(session, m, policy)
+}
+
+// registerCommands creates the application commands of the bot, replacing
+// the ones it had before.
+func registerCommands(session *dgo.Session) error {
+	_, err := session.ApplicationCommandBulkOverwrite(session.State.User.ID, "", applicationCommands)
+	return err
+}
+
+func interactionUser(i *dgo.InteractionCreate) *dgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// translateMessageCommand answers the "Translate" entry of the message context
+// menu with a translation only the user can see, in their language.
+func translateMessageCommand(session *dgo.Session, i *dgo.InteractionCreate) error {
+	err := session.InteractionRespond(i.Interaction, &dgo.InteractionResponse{
+		Type: dgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &dgo.InteractionResponseData{Flags: dgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		return err
+	}
+	reply := func(content string, embeds ...*dgo.MessageEmbed) error {
+		_, err := session.InteractionResponseEdit(i.Interaction, &dgo.WebhookEdit{Content: &content, Embeds: &embeds})
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	message, ok := data.Resolved.Messages[data.TargetID]
+	if !ok {
+		return reply("I could not find that message.")
+	}
+	targetLanguage := getUserLanguage(interactionUser(i).ID)
+	if URL := tweetURLRegex.FindString(message.Content); URL != "" {
+		return translateTweetCommand(session, i.GuildID, message.ChannelID, URL, targetLanguage, reply)
+	}
+	text := messageText(message)
+	if text == "" {
+		return reply("There is no text to translate in that message.")
+	}
+	result, err := translateText(text, i.GuildID, targetLanguage)
+	if err != nil {
+		reply("Sorry, something went wrong.")
+		return err
+	}
+	embed := translationEmbed(result, targetLanguage)
+	embed.URL = fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildOrMe(i.GuildID), message.ChannelID, message.ID)
+	embed.Title = "Translation"
+	return reply("", embed)
+}
+
+// translateTweetCommand answers the Translate command on a message that links
+// a tweet with the translation of the tweet, unless translations are off in
+// the channel of the message.
+func translateTweetCommand(session *dgo.Session, guild, channel, URL, targetLanguage string, reply func(string, ...*dgo.MessageEmbed) error) error {
+	terms, err := getGlossary(guild)
+	if err != nil {
+		logger.Printf("Could not get the glossary of guild %s: %v\n", guild, err)
+	}
+	policy, err := getTranslationPolicy(session, guild, channel)
+	if err != nil {
+		reply("Sorry, something went wrong.")
+		return err
+	}
+	if policy.Mode == translationOff {
+		return reply("Tweets are not translated in that channel.")
+	}
+	policy.TargetLanguage = targetLanguage
+	policy.SourceLanguages = nil
+	id, _ := tweetId(URL)
+	cached, err := translateTweet(id, URL, policy, terms)
+	if err != nil {
+		reply("Sorry, something went wrong.")
+		return err
+	}
+	if cached == nil {
+		return reply(fmt.Sprintf("There is nothing to translate to %s in that tweet.", targetLanguage))
+	}
+	return reply("", tweetEmbed(cached.Tweet, cached.Original, cached.Translation))
+}
+
+// guildOrMe returns the guild part of a message link, which is @me in DMs.
+func guildOrMe(guild string) string {
+	if guild == "" {
+		return "@me"
+	}
+	return guild
+}
+
+func interactionHandler(session *dgo.Session, i *dgo.InteractionCreate) {
+	if i.Type != dgo.InteractionApplicationCommand {
+		return
+	}
+	var err error
+	switch i.ApplicationCommandData().Name {
+	case "Translate":
+		err = translateMessageCommand(session, i)
+	}
+	if err != nil {
+		logger.Printf("Error handling the %s command: %v\n", i.ApplicationCommandData().Name, err)
+	}
+}
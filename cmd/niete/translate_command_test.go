@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestLeadingLanguage(t *testing.T) {
+	tests := []struct {
+		text, language, rest string
+	}{
+		{"ES hello there", "ES", "hello there"},
+		{"  EN-GB\nline one\nline two ", "EN-GB", "line one\nline two"},
+		{"PT-BR olá", "PT-BR", "olá"},
+		// Lower case words are part of the text.
+		{"it is raining", "", "it is raining"},
+		{"no way", "", "no way"},
+		// A code alone is the text to translate.
+		{"ES", "", "ES"},
+		{"OK then", "", "OK then"},
+		{"こんにちは", "", "こんにちは"},
+	}
+	for _, test := range tests {
+		language, rest := leadingLanguage(test.text)
+		if language != test.language || rest != test.rest {
+			t.Errorf("leadingLanguage(%q) = %q, %q, want %q, %q", test.text, language, rest, test.language, test.rest)
+		}
+	}
+}
+
+func TestIsTargetLanguage(t *testing.T) {
+	tests := map[string]bool{
+		"EN":      true,
+		"en-gb":   true,
+		"ZH-HANT": true,
+		"EN-AU":   false,
+		"XX":      false,
+		"":        false,
+	}
+	for code, want := range tests {
+		if got := isTargetLanguage(code); got != want {
+			t.Errorf("isTargetLanguage(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
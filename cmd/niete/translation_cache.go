@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Official tweets get pasted again for a few days at most.
+const translationCacheTTL = 7 * 24 * time.Hour
+
+// cachedTranslation is a tweet together with its translation, so that posting
+// the same tweet again needs neither the tweet nor the translator.
+type cachedTranslation struct {
+	Key            string       `bson:"key"`
+	TweetId        string       `bson:"tweetId"`
+	TargetLanguage string       `bson:"targetLanguage"`
+	Formality      string       `bson:"formality"`
+	GlossaryHash   string       `bson:"glossaryHash"`
+	Tweet          *tweet       `bson:"tweet"`
+	Original       string       `bson:"original"`
+	Translation    *translation `bson:"translation"`
+	Created        time.Time    `bson:"created"`
+}
+
+type translationStats struct {
+	Hits                 int64 `bson:"hits"`
+	Misses               int64 `bson:"misses"`
+	CharactersTranslated int64 `bson:"charactersTranslated"`
+	CharactersSaved      int64 `bson:"charactersSaved"`
+}
+
+func translationCacheKey(tweetId string, opts translationOptions, glossaryHash string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", tweetId, opts.TargetLanguage, opts.Formality, glossaryHash)
+}
+
+// setupTranslationCache creates the indexes of the translation cache. Entries
+// are removed by MongoDB once they are older than translationCacheTTL.
+func setupTranslationCache() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("translationCache").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"key": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"created": 1}, Options: options.Index().SetExpireAfterSeconds(int32(translationCacheTTL.Seconds()))},
+	})
+	return err
+}
+
+func getCachedTranslation(tweetId string, opts translationOptions, glossaryHash string) (*cachedTranslation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var cached cachedTranslation
+	err := getDatabase().Collection("translationCache").FindOne(
+		ctx,
+		bson.M{"key": translationCacheKey(tweetId, opts, glossaryHash)},
+	).Decode(&cached)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cached, nil
+}
+
+func saveCachedTranslation(cached *cachedTranslation) error {
+	cached.Key = translationCacheKey(
+		cached.TweetId,
+		translationOptions{TargetLanguage: cached.TargetLanguage, Formality: cached.Formality},
+		cached.GlossaryHash,
+	)
+	cached.Created = time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("translationCache").ReplaceOne(
+		ctx,
+		bson.M{"key": cached.Key},
+		cached,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// recordTranslation counts a translation in the stats. Hits are the
+// translations that came from the cache, and their characters are the ones
+// the translator did not have to be paid for.
+func recordTranslation(hit bool, characters int) {
+	inc := bson.M{"misses": 1, "charactersTranslated": characters}
+	if hit {
+		inc = bson.M{"hits": 1, "charactersSaved": characters}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("translationStats").UpdateOne(
+		ctx,
+		bson.M{"_id": "tweets"},
+		bson.M{"$inc": inc},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		logger.Printf("Could not update the translation stats: %v\n", err)
+	}
+}
+
+func sendTranslationStats(session *dgo.Session, channel string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var stats translationStats
+	err := getDatabase().Collection("translationStats").FindOne(ctx, bson.M{"_id": "tweets"}).Decode(&stats)
+	if err != nil && err != mongo.ErrNoDocuments {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	cached, err := getDatabase().Collection("translationCache").CountDocuments(ctx, bson.M{})
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+
+	hitRate := 0.0
+	if total := stats.Hits + stats.Misses; total > 0 {
+		hitRate = float64(stats.Hits) / float64(total) * 100
+	}
+	embed := &dgo.MessageEmbed{
+		Title: "Tweet translations",
+		Fields: []*dgo.MessageEmbedField{
+			{Name: "Cache hits", Value: fmt.Sprintf("%s (%.1f%%)", intComma(int(stats.Hits)), hitRate), Inline: true},
+			{Name: "Translated", Value: intComma(int(stats.Misses)), Inline: true},
+			{Name: "Cached tweets", Value: intComma(int(cached)), Inline: true},
+			{Name: "Characters translated", Value: intComma(int(stats.CharactersTranslated)), Inline: true},
+			{Name: "Characters saved", Value: intComma(int(stats.CharactersSaved)), Inline: true},
+		},
+		Footer: &dgo.MessageEmbedFooter{Text: "Translations are cached for 7 days."},
+	}
+	_, err = session.ChannelMessageSendEmbed(channel, embed)
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestTranslationCacheKey(t *testing.T) {
+	base := translationCacheKey("1", translationOptions{TargetLanguage: "EN-GB", Formality: "default"}, "abc")
+	if base != "1:EN-GB:default:abc" {
+		t.Errorf("got key %q", base)
+	}
+	// Asking for the same tweet in another way must not hit the cache.
+	tests := map[string]struct {
+		tweetId string
+		opts    translationOptions
+		hash    string
+	}{
+		"tweet":     {"2", translationOptions{TargetLanguage: "EN-GB", Formality: "default"}, "abc"},
+		"language":  {"1", translationOptions{TargetLanguage: "ES", Formality: "default"}, "abc"},
+		"formality": {"1", translationOptions{TargetLanguage: "EN-GB", Formality: "more"}, "abc"},
+		"glossary":  {"1", translationOptions{TargetLanguage: "EN-GB", Formality: "default"}, "def"},
+	}
+	for name, test := range tests {
+		if key := translationCacheKey(test.tweetId, test.opts, test.hash); key == base {
+			t.Errorf("another %s has the same key %q", name, key)
+		}
+	}
+	// The source language is detected, so it does not change the key.
+	opts := translationOptions{TargetLanguage: "EN-GB", SourceLanguage: "JA", Formality: "default"}
+	if key := translationCacheKey("1", opts, "abc"); key != base {
+		t.Errorf("the source language changed the key to %q", key)
+	}
+}
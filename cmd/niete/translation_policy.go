@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How tweets posted in a channel get translated.
+const (
+	translationOff = "off"
+	// Every tweet is translated as soon as it is posted.
+	translationAuto = "auto"
+	// Tweets are translated when someone reacts to them.
+	translationReaction = "reaction"
+	// Tweets are translated only with $translate or the Translate command.
+	translationRequest = "request"
+)
+
+var (
+	translationModes = []string{translationOff, translationAuto, translationReaction, translationRequest}
+	formalities      = []string{"default", "more", "less", "prefer_more", "prefer_less"}
+)
+
+type translationPolicy struct {
+	GuildId        string `bson:"guildId"`
+	ChannelId      string `bson:"channelId"`
+	Mode           string `bson:"mode"`
+	TargetLanguage string `bson:"targetLanguage"`
+	Formality      string `bson:"formality"`
+	// Only tweets in these languages are translated. Empty for any language.
+	SourceLanguages []string `bson:"sourceLanguages"`
+	// The reaction that translates a message in the reaction mode. Empty for
+	// defaultTranslationEmoji.
+	Emoji string `bson:"emoji"`
+}
+
+// defaultTranslationPolicy is the policy of the channels nobody configured:
+// tweets are translated to English, except in TRANSLATION_FORBIDDEN_CHANNELS.
+func defaultTranslationPolicy(guild, channel string) *translationPolicy {
+	policy := &translationPolicy{
+		GuildId:        guild,
+		ChannelId:      channel,
+		Mode:           translationAuto,
+		TargetLanguage: defaultTargetLanguage,
+		Formality:      "prefer_less",
+	}
+	forbidden := strings.Split(translationForbiddenChannels, ",")
+	if slices.ContainsFunc(forbidden, func(id string) bool { return strings.TrimSpace(id) == channel }) {
+		policy.Mode = translationOff
+	}
+	return policy
+}
+
+// threadParent returns the channel a thread was started in, or an empty
+// string if the channel is not a thread.
+func threadParent(session *dgo.Session, channel string) string {
+	thread, err := session.State.Channel(channel)
+	if err != nil {
+		thread, err = session.Channel(channel)
+	}
+	if err != nil || !thread.IsThread() {
+		return ""
+	}
+	return thread.ParentID
+}
+
+// getTranslationPolicy returns the policy of a channel. Threads without a
+// policy of their own follow the one of their channel.
+func getTranslationPolicy(session *dgo.Session, guild, channel string) (*translationPolicy, error) {
+	channels := []string{channel}
+	if parent := threadParent(session, channel); parent != "" {
+		channels = append(channels, parent)
+	}
+	policy := defaultTranslationPolicy(guild, channels[len(channels)-1])
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, id := range channels {
+		err := getDatabase().Collection("translationPolicies").FindOne(ctx, bson.M{"channelId": id}).Decode(policy)
+		if err == nil {
+			break
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+	// Changing the policy of a thread does not change the one of its channel.
+	policy.ChannelId = channel
+	return policy, nil
+}
+
+func saveTranslationPolicy(policy *translationPolicy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("translationPolicies").ReplaceOne(
+		ctx,
+		bson.M{"channelId": policy.ChannelId},
+		policy,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func deleteTranslationPolicy(channel string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := getDatabase().Collection("translationPolicies").DeleteOne(ctx, bson.M{"channelId": channel})
+	return err
+}
+
+// sameLanguage compares two language codes without their variants, so that
+// EN and EN-GB are the same language.
+func sameLanguage(a, b string) bool {
+	a, _, _ = strings.Cut(a, "-")
+	b, _, _ = strings.Cut(b, "-")
+	return strings.EqualFold(a, b)
+}
+
+func (p *translationPolicy) options() translationOptions {
+	return translationOptions{TargetLanguage: p.TargetLanguage, Formality: p.Formality}
+}
+
+// allows tells whether tweets in language should be translated. An unknown
+// language is allowed, since it is only known after translating.
+func (p *translationPolicy) allows(language string) bool {
+	return len(p.SourceLanguages) == 0 || language == "" || slices.Contains(p.SourceLanguages, strings.ToUpper(language))
+}
+
+func (p *translationPolicy) emoji() string {
+	if p.Emoji == "" {
+		return defaultTranslationEmoji
+	}
+	return p.Emoji
+}
+
+func (p *translationPolicy) String() string {
+	sources := "any"
+	if len(p.SourceLanguages) > 0 {
+		sources = strings.Join(p.SourceLanguages, ", ")
+	}
+	description := fmt.Sprintf(
+		"Mode: `%s`\nTarget language: `%s`\nFormality: `%s`\nSource languages: `%s`",
+		p.Mode, p.TargetLanguage, p.Formality, sources,
+	)
+	if p.Mode == translationReaction {
+		emoji := p.emoji()
+		if strings.Contains(emoji, ":") {
+			emoji = "<:" + emoji + ">"
+		}
+		description += "\nReact with " + emoji + " to translate a message."
+	}
+	return description
+}
+
+func configHandler(session *dgo.Session, channel, guild, userId string, args []string) error {
+	if len(args) == 0 || args[0] != "translate" {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$config translate [mode|lang|formality|sources|emoji|reset] ...`")
+		return err
+	}
+	return translationPolicyHandler(session, channel, guild, userId, args[1:])
+}
+
+func translationPolicyHandler(session *dgo.Session, channel, guild, userId string, args []string) error {
+	policy, err := getTranslationPolicy(session, guild, channel)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	if len(args) == 0 {
+		_, err = session.ChannelMessageSend(channel, "Translations in this channel:\n"+policy.String())
+		return err
+	}
+	if !isAdmin(session, channel, userId) {
+		_, err = session.ChannelMessageSend(channel, "Only admins can configure the translations.")
+		return err
+	}
+
+	switch {
+	case args[0] == "mode" && len(args) == 2 && slices.Contains(translationModes, args[1]):
+		policy.Mode = args[1]
+	case args[0] == "lang" && len(args) == 2 && isTargetLanguage(args[1]):
+		policy.TargetLanguage = strings.ToUpper(args[1])
+	case args[0] == "formality" && len(args) == 2 && slices.Contains(formalities, args[1]):
+		policy.Formality = args[1]
+	case args[0] == "sources" && len(args) == 2 && args[1] == "any":
+		policy.SourceLanguages = nil
+	case args[0] == "sources" && len(args) > 1:
+		policy.SourceLanguages = nil
+		for _, language := range args[1:] {
+			policy.SourceLanguages = append(policy.SourceLanguages, strings.ToUpper(language))
+		}
+	case args[0] == "emoji" && len(args) == 2:
+		policy.Emoji = parseEmoji(args[1])
+	case args[0] == "reset" && len(args) == 1:
+		if err = deleteTranslationPolicy(channel); err != nil {
+			session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+			return err
+		}
+		// The defaults of a thread are the policy of its channel.
+		if policy, err = getTranslationPolicy(session, guild, channel); err != nil {
+			session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+			return err
+		}
+		_, err = session.ChannelMessageSend(channel, "Translations in this channel are back to the defaults:\n"+policy.String())
+		return err
+	default:
+		_, err = session.ChannelMessageSend(
+			channel,
+			fmt.Sprintf(
+				"Usage: `$config translate [mode %s|lang <code>|formality %s|sources <codes...>|sources any|emoji <emoji>|reset]`",
+				strings.Join(translationModes, "|"),
+				strings.Join(formalities, "|"),
+			),
+		)
+		return err
+	}
+
+	if err = saveTranslationPolicy(policy); err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = session.ChannelMessageSend(channel, "Translations in this channel:\n"+policy.String())
+	return err
+}
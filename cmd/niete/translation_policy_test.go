@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+func TestSameLanguage(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"EN", "EN", true},
+		{"EN", "EN-GB", true},
+		{"en-us", "EN-GB", true},
+		{"PT-BR", "pt", true},
+		{"JA", "EN", false},
+		{"ZH-HANT", "JA", false},
+		{"", "EN", false},
+	}
+	for _, test := range tests {
+		if got := sameLanguage(test.a, test.b); got != test.want {
+			t.Errorf("sameLanguage(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	tests := []struct {
+		sources  []string
+		language string
+		want     bool
+	}{
+		{nil, "JA", true},
+		{[]string{"JA", "KO"}, "JA", true},
+		{[]string{"JA", "KO"}, "ko", true},
+		{[]string{"JA", "KO"}, "EN", false},
+		// The language of a tweet is not always known before translating it.
+		{[]string{"JA"}, "", true},
+	}
+	for _, test := range tests {
+		policy := &translationPolicy{SourceLanguages: test.sources}
+		if got := policy.allows(test.language); got != test.want {
+			t.Errorf("sources %v allow %q = %v, want %v", test.sources, test.language, got, test.want)
+		}
+	}
+}
+
+func TestDefaultTranslationPolicy(t *testing.T) {
+	previous := translationForbiddenChannels
+	t.Cleanup(func() { translationForbiddenChannels = previous })
+	translationForbiddenChannels = "1, 2"
+	tests := map[string]string{
+		"1":  translationOff,
+		"2":  translationOff,
+		"3":  translationAuto,
+		"12": translationAuto,
+	}
+	for channel, want := range tests {
+		if got := defaultTranslationPolicy("guild", channel).Mode; got != want {
+			t.Errorf("channel %s is %s by default, want %s", channel, got, want)
+		}
+	}
+}
+
+func TestThreadParent(t *testing.T) {
+	session, err := dgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Client = &http.Client{Transport: fakeDiscord{}}
+	err = session.State.GuildAdd(&dgo.Guild{
+		ID:       "guild",
+		Channels: []*dgo.Channel{{ID: "channel", GuildID: "guild", Type: dgo.ChannelTypeGuildText}},
+		Threads: []*dgo.Channel{
+			{ID: "thread", GuildID: "guild", ParentID: "channel", Type: dgo.ChannelTypeGuildPublicThread},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"thread":  "channel",
+		"channel": "",
+		// Channels missing from the state are asked to Discord.
+		"1": "",
+	}
+	for channel, want := range tests {
+		if got := threadParent(session, channel); got != want {
+			t.Errorf("threadParent(%s) = %q, want %q", channel, got, want)
+		}
+	}
+}
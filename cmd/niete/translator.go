@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var errQuotaExceeded = errors.New("the translation quota has been exceeded")
+
+type translationOptions struct {
+	TargetLanguage string
+	// Empty to let the backend detect it.
+	SourceLanguage string
+	// One of DeepL's formality values. Ignored by the backends without it.
+	Formality string
+}
+
+type translation struct {
+	Text           string `bson:"text"`
+	SourceLanguage string `bson:"sourceLanguage"`
+	Translator     string `bson:"translator"`
+	// Number of characters sent to the backend.
+	Characters int `bson:"characters"`
+}
+
+type translator interface {
+	name() string
+	translate(text string, opts translationOptions) (*translation, error)
+}
+
+// statusError turns the status codes that mean "no more translations for
+// now" into errQuotaExceeded.
+func statusError(err error, quotaCodes ...int) error {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		for _, code := range quotaCodes {
+			if statusErr.StatusCode == code {
+				return fmt.Errorf("%w: %v", errQuotaExceeded, err)
+			}
+		}
+	}
+	return err
+}
+
+type deeplTranslator struct {
+	label    string
+	endpoint string
+	key      string
+}
+
+func (t *deeplTranslator) name() string {
+	return t.label
+}
+
+func (t *deeplTranslator) translate(text string, opts translationOptions) (*translation, error) {
+	payload := map[string]any{"text": [1]string{text}, "target_lang": opts.TargetLanguage}
+	if opts.SourceLanguage != "" {
+		payload["source_lang"] = opts.SourceLanguage
+	}
+	if opts.Formality != "" {
+		payload["formality"] = opts.Formality
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	body, err = web.fetch(outboundRequest{
+		Method: http.MethodPost,
+		URL:    t.endpoint,
+		Header: http.Header{
+			"Content-Type":  {"application/json"},
+			"Authorization": {fmt.Sprintf("DeepL-Auth-Key %s", t.key)},
+		},
+		Body: body,
+	})
+	if err != nil {
+		// DeepL answers 456 when the character quota is used up.
+		return nil, statusError(err, 456, http.StatusTooManyRequests)
+	}
+	var response struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Translations) == 0 {
+		return nil, fmt.Errorf("%s returned no translations", t.label)
+	}
+	return &translation{
+		Text:           response.Translations[0].Text,
+		SourceLanguage: strings.ToUpper(response.Translations[0].DetectedSourceLanguage),
+		Translator:     t.label,
+		Characters:     len([]rune(text)),
+	}, nil
+}
+
+type libreTranslator struct {
+	url string
+	key string
+}
+
+func (t *libreTranslator) name() string {
+	return "LibreTranslate"
+}
+
+func (t *libreTranslator) translate(text string, opts translationOptions) (*translation, error) {
+	source := strings.ToLower(opts.SourceLanguage)
+	if source == "" {
+		source = "auto"
+	}
+	// LibreTranslate only knows about the language, not about its variants.
+	target, _, _ := strings.Cut(strings.ToLower(opts.TargetLanguage), "-")
+	payload := map[string]any{"q": text, "source": source, "target": target, "format": "text"}
+	if t.key != "" {
+		payload["api_key"] = t.key
+	}
+	body, err := web.postJSON(strings.TrimSuffix(t.url, "/")+"/translate", payload, 0)
+	if err != nil {
+		return nil, statusError(err, http.StatusTooManyRequests, http.StatusForbidden)
+	}
+	var response struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	sourceLanguage := response.DetectedLanguage.Language
+	if sourceLanguage == "" {
+		sourceLanguage = opts.SourceLanguage
+	}
+	return &translation{
+		Text:           response.TranslatedText,
+		SourceLanguage: strings.ToUpper(sourceLanguage),
+		Translator:     t.name(),
+		Characters:     len([]rune(text)),
+	}, nil
+}
+
+// deeplxTranslator talks to a self-hosted DeepLX instance, a stand-in for
+// DeepL that needs no API key.
+type deeplxTranslator struct {
+	url string
+}
+
+func (t *deeplxTranslator) name() string {
+	return "DeepLX"
+}
+
+func (t *deeplxTranslator) translate(text string, opts translationOptions) (*translation, error) {
+	source := opts.SourceLanguage
+	if source == "" {
+		source = "auto"
+	}
+	payload := map[string]string{"text": text, "source_lang": source, "target_lang": opts.TargetLanguage}
+	body, err := web.postJSON(t.url, payload, 0)
+	if err != nil {
+		return nil, statusError(err, http.StatusTooManyRequests)
+	}
+	var response struct {
+		Code       int    `json:"code"`
+		Data       string `json:"data"`
+		SourceLang string `json:"source_lang"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.Code != 0 && response.Code != http.StatusOK {
+		return nil, fmt.Errorf("DeepLX returned code %d", response.Code)
+	}
+	return &translation{
+		Text:           response.Data,
+		SourceLanguage: strings.ToUpper(response.SourceLang),
+		Translator:     t.name(),
+		Characters:     len([]rune(text)),
+	}, nil
+}
+
+// fallbackTranslator tries its translators in order until one of them works.
+type fallbackTranslator struct {
+	translators []translator
+}
+
+func (t *fallbackTranslator) name() string {
+	names := make([]string, len(t.translators))
+	for i, backend := range t.translators {
+		names[i] = backend.name()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (t *fallbackTranslator) translate(text string, opts translationOptions) (*translation, error) {
+	var errs []error
+	for _, backend := range t.translators {
+		result, err := backend.translate(text, opts)
+		if err == nil {
+			return result, nil
+		}
+		logger.Printf("Translation with %s failed, trying the next one: %v\n", backend.name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", backend.name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// newTranslator builds the translators listed in TRANSLATORS, in order. They
+// default to DeepL Free with DEEPL_KEY.
+func newTranslator() (translator, error) {
+	var names, deeplURL, deeplProKey, deeplProURL string
+	if getToken(&names, "TRANSLATORS") != nil {
+		names = "deepl-free"
+	}
+	getToken(&deeplURL, "DEEPL_URL")
+	// Free keys do not work with the Pro API, so it has its own.
+	getToken(&deeplProKey, "DEEPL_PRO_KEY")
+	getToken(&deeplProURL, "DEEPL_PRO_URL")
+
+	fallback := &fallbackTranslator{}
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.TrimSpace(name)
+		var backend translator
+		switch name {
+		case "deepl-free":
+			if deeplKey == "" {
+				return nil, fmt.Errorf("DEEPL_KEY not set")
+			}
+			if deeplURL == "" {
+				deeplURL = "https://api-free.deepl.com/v2/translate"
+			}
+			backend = &deeplTranslator{label: "DeepL", endpoint: deeplURL, key: deeplKey}
+		case "deepl-pro":
+			if deeplProKey == "" {
+				fmt.Println("DEEPL_PRO_KEY not set, not using DeepL Pro.")
+				continue
+			}
+			if deeplProURL == "" {
+				deeplProURL = "https://api.deepl.com/v2/translate"
+			}
+			backend = &deeplTranslator{label: "DeepL Pro", endpoint: deeplProURL, key: deeplProKey}
+		case "libretranslate":
+			libre := &libreTranslator{}
+			if err := getToken(&libre.url, "LIBRETRANSLATE_URL"); err != nil {
+				return nil, err
+			}
+			getToken(&libre.key, "LIBRETRANSLATE_KEY")
+			backend = libre
+		case "deeplx":
+			deeplx := &deeplxTranslator{}
+			if err := getToken(&deeplx.url, "DEEPLX_URL"); err != nil {
+				return nil, err
+			}
+			backend = deeplx
+		default:
+			return nil, fmt.Errorf("unknown translator %q", name)
+		}
+		fallback.translators = append(fallback.translators, backend)
+	}
+	if len(fallback.translators) == 0 {
+		return nil, fmt.Errorf("no translator can be used")
+	}
+	return fallback, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Jrryy/Niete/internal/faketranslator"
+)
+
+func newFakeTranslators(t *testing.T, options *faketranslator.Options) (*deeplTranslator, *libreTranslator, *deeplxTranslator) {
+	t.Helper()
+	server := httptest.NewServer(faketranslator.Handler(options))
+	t.Cleanup(server.Close)
+	return &deeplTranslator{label: "DeepL", endpoint: server.URL + "/v2/translate", key: "fake"},
+		&libreTranslator{url: server.URL},
+		&deeplxTranslator{url: server.URL + "/deeplx/translate"}
+}
+
+func TestTranslators(t *testing.T) {
+	deepl, libre, deeplx := newFakeTranslators(t, &faketranslator.Options{})
+	for _, backend := range []translator{deepl, libre, deeplx} {
+		t.Run(backend.name(), func(t *testing.T) {
+			result, err := backend.translate("こんにちは", translationOptions{TargetLanguage: "EN"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Text != "[EN] こんにちは" || result.SourceLanguage != "JA" || result.Characters != 5 {
+				t.Errorf("got %+v", result)
+			}
+		})
+	}
+}
+
+func TestDeepLQuotaExceeded(t *testing.T) {
+	deepl, _, _ := newFakeTranslators(t, &faketranslator.Options{DeepLQuotaExceeded: true})
+	_, err := deepl.translate("こんにちは", translationOptions{TargetLanguage: "EN"})
+	if !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("got %v, want errQuotaExceeded", err)
+	}
+}
+
+func TestFallbackTranslator(t *testing.T) {
+	deepl, libre, deeplx := newFakeTranslators(t, &faketranslator.Options{DeepLQuotaExceeded: true})
+	fallback := &fallbackTranslator{translators: []translator{deepl, libre, deeplx}}
+	result, err := fallback.translate("こんにちは", translationOptions{TargetLanguage: "EN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Translator != libre.name() {
+		t.Errorf("translated by %s, want %s", result.Translator, libre.name())
+	}
+}
+
+func TestFallbackTranslatorAllFailing(t *testing.T) {
+	options := &faketranslator.Options{DeepLQuotaExceeded: true, LibreTranslateDown: true}
+	deepl, libre, _ := newFakeTranslators(t, options)
+	fallback := &fallbackTranslator{translators: []translator{deepl, libre}}
+	_, err := fallback.translate("こんにちは", translationOptions{TargetLanguage: "EN"})
+	if !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("got %v, want it to wrap errQuotaExceeded", err)
+	}
+}
+
+func TestNewTranslator(t *testing.T) {
+	previousKey := deeplKey
+	t.Cleanup(func() { deeplKey = previousKey })
+	deeplKey = "free:fx"
+	t.Setenv("TRANSLATORS", "deepl-free,deepl-pro")
+	t.Setenv("DEEPL_URL", "http://localhost/free")
+	t.Setenv("DEEPL_PRO_KEY", "")
+	os.Unsetenv("DEEPL_PRO_KEY")
+
+	backend, err := newTranslator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := backend.(*fallbackTranslator).translators; len(got) != 1 || got[0].name() != "DeepL" {
+		t.Errorf("without DEEPL_PRO_KEY, got %v", got)
+	}
+
+	t.Setenv("DEEPL_PRO_KEY", "pro")
+	backend, err = newTranslator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := backend.(*fallbackTranslator).translators
+	if len(got) != 2 {
+		t.Fatalf("got %v", got)
+	}
+	free, pro := got[0].(*deeplTranslator), got[1].(*deeplTranslator)
+	if free.key != "free:fx" || free.endpoint != "http://localhost/free" {
+		t.Errorf("DeepL Free is %+v", free)
+	}
+	if pro.key != "pro" || pro.endpoint != "https://api.deepl.com/v2/translate" {
+		t.Errorf("DeepL Pro is %+v", pro)
+	}
+
+	t.Setenv("TRANSLATORS", "deepl-pro")
+	os.Unsetenv("DEEPL_PRO_KEY")
+	if _, err = newTranslator(); err == nil {
+		t.Error("got no error without any usable translator")
+	}
+}
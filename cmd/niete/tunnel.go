@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultNgrokRegion = "eu"
+	defaultNgrokAPI    = "http://localhost:4040"
+	tunnelAttempts     = 10
+	tunnelPollPeriod   = time.Second
+)
+
+var errNoTunnel = errors.New("ngrok did not open a tunnel to the port")
+
+// tunnel makes the server reachable from outside.
+type tunnel interface {
+	name() string
+	// open exposes the local port and returns the public address, and the
+	// process keeping the tunnel open if there is one.
+	open(port int) (*process, string, error)
+}
+
+// ngrokTunnel opens a TCP tunnel with ngrok and asks its local API for the
+// address it got.
+type ngrokTunnel struct {
+	path, region, api string
+}
+
+func (t *ngrokTunnel) name() string {
+	return "ngrok"
+}
+
+func (t *ngrokTunnel) open(port int) (*process, string, error) {
+	ngrok, err := startProcess(exec.Command(t.path, "tcp", strconv.Itoa(port), "--region", t.region))
+	if err != nil {
+		return nil, "", err
+	}
+	address, err := t.address(port)
+	if err != nil {
+		ngrok.stop(syscall.SIGTERM, false, 5*time.Second)
+		return nil, "", err
+	}
+	return ngrok, address, nil
+}
+
+// tunnelPort returns the port of the local address of a tunnel, which ngrok
+// shows as a URL, a host:port or just the port.
+func tunnelPort(addr string) string {
+	if _, after, found := strings.Cut(addr, "://"); found {
+		addr = after
+	}
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		return port
+	}
+	return addr
+}
+
+// address polls the API of ngrok until it has opened the tunnel to the port.
+// Other tunnels can show up in the same API, so the first one is not always
+// ours.
+func (t *ngrokTunnel) address(port int) (string, error) {
+	var response struct {
+		Tunnels []struct {
+			PublicURL string `json:"public_url"`
+			Config    struct {
+				Addr string `json:"addr"`
+			} `json:"config"`
+		} `json:"tunnels"`
+	}
+	var err error
+	for attempt := range tunnelAttempts {
+		if attempt > 0 {
+			time.Sleep(tunnelPollPeriod)
+		}
+		var body []byte
+		body, err = web.get(t.api+"/api/tunnels", 0)
+		if err != nil {
+			continue
+		}
+		if err = json.Unmarshal(body, &response); err != nil {
+			return "", err
+		}
+		for _, opened := range response.Tunnels {
+			if tunnelPort(opened.Config.Addr) == strconv.Itoa(port) {
+				return strings.TrimPrefix(opened.PublicURL, "tcp://"), nil
+			}
+		}
+		err = errNoTunnel
+	}
+	return "", err
+}
+
+// staticTunnel is for servers that are reachable on their own, with port
+// forwarding, at a fixed address.
+type staticTunnel struct {
+	address string
+}
+
+func (t *staticTunnel) name() string {
+	return "static"
+}
+
+func (t *staticTunnel) open(int) (*process, string, error) {
+	return nil, t.address, nil
+}
+
+// fakeTunnel runs a process that does nothing in place of the tunnel, to try
+// the bot without exposing anything. Killing the process looks like the
+// tunnel going down.
+type fakeTunnel struct{}
+
+func (t *fakeTunnel) name() string {
+	return "fake"
+}
+
+func (t *fakeTunnel) open(port int) (*process, string, error) {
+	fake, err := startProcess(exec.Command("sleep", "infinity"))
+	if err != nil {
+		return nil, "", err
+	}
+	return fake, net.JoinHostPort("fake.tunnel", strconv.Itoa(port)), nil
+}
+
+// newTunnel returns the tunnel of the given kind. address is the public
+// address of the static one, and api the local API of ngrok if it is not
+// NGROK_API_URL.
+func newTunnel(kind, address, api string) (tunnel, error) {
+	switch kind {
+	case "ngrok":
+		t := &ngrokTunnel{region: defaultNgrokRegion, api: defaultNgrokAPI}
+		if err := getToken(&t.path, "NGROK_PATH"); err != nil {
+			return nil, err
+		}
+		getToken(&t.region, "NGROK_REGION")
+		getToken(&t.api, "NGROK_API_URL")
+		if api != "" {
+			t.api = api
+		}
+		t.api = strings.TrimSuffix(t.api, "/")
+		return t, nil
+	case "static":
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("the address of a static tunnel should be a host:port: %w", err)
+		}
+		return &staticTunnel{address: address}, nil
+	case "fake":
+		return &fakeTunnel{}, nil
+	case "", "none":
+		// Nothing to open, and no address to show.
+		return &staticTunnel{}, nil
+	}
+	return nil, fmt.Errorf("unknown tunnel %q", kind)
+}
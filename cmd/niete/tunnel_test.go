@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTunnelPort(t *testing.T) {
+	tests := map[string]string{
+		"localhost:25565":       "25565",
+		"tcp://localhost:25565": "25565",
+		"http://127.0.0.1:7777": "7777",
+		"25565":                 "25565",
+		"tcp://[::1]:25565":     "25565",
+	}
+	for addr, want := range tests {
+		if got := tunnelPort(addr); got != want {
+			t.Errorf("tunnelPort(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestNgrokAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/tunnels" {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Write([]byte(`{"tunnels": [
+			{"public_url": "tcp://0.tcp.eu.ngrok.io:11111", "config": {"addr": "localhost:7777"}},
+			{"public_url": "tcp://0.tcp.eu.ngrok.io:22222", "config": {"addr": "localhost:25565"}}
+		]}`))
+	}))
+	defer server.Close()
+	t.Setenv("NGROK_PATH", "ngrok")
+	api := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	opened, err := newTunnel("ngrok", "", api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := opened.(*ngrokTunnel).address(25565)
+	if err != nil || address != "0.tcp.eu.ngrok.io:22222" {
+		t.Errorf("got %q, %v for the second tunnel", address, err)
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/go-rod/rod"
+)
+
+const (
+	tweetCacheTTL = 10 * time.Minute
+	// Discord rejects embed fields longer than this.
+	embedFieldLimit = 1024
+	// The most characters Discord takes in the text of an embed, and in all the
+	// embeds of a message together.
+	embedTotalLimit = 6000
+	// The most embeds Discord takes in a message.
+	messageEmbedLimit = 10
+	twitterBlue       = 0x1d9bf0
+)
+
+var (
+	errTweetNotFound = errors.New("the tweet does not exist or is not public")
+	tweetURLRegex    = regexp.MustCompile(`https://(?:www\.|mobile\.)?(?:twitter|x)\.com/(\S+)/status/(\d+)`)
+)
+
+type tweetAuthor struct {
+	Name       string `bson:"name"`
+	ScreenName string `bson:"screenName"`
+	AvatarURL  string `bson:"avatarUrl"`
+}
+
+type tweetMedia struct {
+	// photo, video or gif.
+	Type         string `bson:"type"`
+	URL          string `bson:"url"`
+	ThumbnailURL string `bson:"thumbnailUrl"`
+}
+
+type tweet struct {
+	Id       string       `bson:"id"`
+	URL      string       `bson:"url"`
+	Author   tweetAuthor  `bson:"author"`
+	Text     string       `bson:"text"`
+	Language string       `bson:"language"`
+	Created  time.Time    `bson:"created"`
+	Media    []tweetMedia `bson:"media"`
+	Quoted   *tweet       `bson:"quoted"`
+}
+
+type tweetFetcher interface {
+	name() string
+	fetch(id, URL string) (*tweet, error)
+}
+
+// tweetId returns the ID of the tweet a status URL points to.
+func tweetId(URL string) (string, bool) {
+	match := tweetURLRegex.FindStringSubmatch(URL)
+	if match == nil {
+		return "", false
+	}
+	return match[2], true
+}
+
+// truncateText cuts text to at most limit characters, ending it with an
+// ellipsis if it had to be cut.
+func truncateText(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit-1]) + "…"
+}
+
+// embedLength counts the characters of an embed that Discord limits to
+// embedTotalLimit.
+func embedLength(embed *dgo.MessageEmbed) int {
+	length := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range embed.Fields {
+		length += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if embed.Footer != nil {
+		length += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	if embed.Author != nil {
+		length += utf8.RuneCountInString(embed.Author.Name)
+	}
+	return length
+}
+
+// embedMessages groups embeds into as few messages as Discord allows.
+func embedMessages(embeds []*dgo.MessageEmbed) [][]*dgo.MessageEmbed {
+	var messages [][]*dgo.MessageEmbed
+	var current []*dgo.MessageEmbed
+	length := 0
+	for _, embed := range embeds {
+		embedSize := embedLength(embed)
+		if len(current) == messageEmbedLimit || (len(current) > 0 && length+embedSize > embedTotalLimit) {
+			messages = append(messages, current)
+			current, length = nil, 0
+		}
+		current = append(current, embed)
+		length += embedSize
+	}
+	if len(current) > 0 {
+		messages = append(messages, current)
+	}
+	return messages
+}
+
+// tweetEmbed builds the embed that shows the translation of a tweet, with the
+// original text hidden behind a spoiler.
+func tweetEmbed(status *tweet, original string, result *translation) *dgo.MessageEmbed {
+	embed := &dgo.MessageEmbed{
+		URL:   status.URL,
+		Color: twitterBlue,
+		Author: &dgo.MessageEmbedAuthor{
+			Name:    status.Author.Name,
+			URL:     status.URL,
+			IconURL: status.Author.AvatarURL,
+		},
+		Footer: &dgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Translated from %s by %s", result.SourceLanguage, result.Translator),
+		},
+	}
+	if status.Author.ScreenName != "" {
+		embed.Author.Name = strings.TrimSpace(fmt.Sprintf("%s (@%s)", status.Author.Name, status.Author.ScreenName))
+	}
+	if embed.Author.Name == "" {
+		embed.Author = nil
+	}
+	if !status.Created.IsZero() {
+		embed.Timestamp = status.Created.Format(time.RFC3339)
+	}
+	embed.Fields = append(embed.Fields, &dgo.MessageEmbedField{
+		Name:  "Original",
+		Value: "||" + truncateText(strings.ReplaceAll(original, "||", "|\u200b|"), embedFieldLimit-4) + "||",
+	})
+	if status.Quoted != nil && status.Quoted.Text != "" {
+		name := "Quoting"
+		if status.Quoted.Author.ScreenName != "" {
+			name += " @" + status.Quoted.Author.ScreenName
+		}
+		embed.Fields = append(embed.Fields, &dgo.MessageEmbedField{
+			Name:  name,
+			Value: truncateText(status.Quoted.Text, embedFieldLimit),
+		})
+	}
+	for _, media := range status.Media {
+		if media.ThumbnailURL != "" {
+			embed.Image = &dgo.MessageEmbedImage{URL: media.ThumbnailURL}
+			break
+		}
+	}
+	embed.Fields = append(embed.Fields, &dgo.MessageEmbedField{
+		Name:  "Link",
+		Value: fmt.Sprintf("[Open the tweet](%s)", status.URL),
+	})
+	if len(status.Media) > 1 {
+		embed.Fields[len(embed.Fields)-1].Value += fmt.Sprintf(" (%d images or videos)", len(status.Media))
+	}
+	// The translation gets whatever the rest of the embed leaves.
+	embed.Description = truncateText(result.Text, min(embedDescriptionLimit, embedTotalLimit-embedLength(embed)))
+	return embed
+}
+
+// fxTwitterFetcher reads tweets from the API of an FxTwitter instance.
+type fxTwitterFetcher struct {
+	url string
+}
+
+type fxTwitterTweet struct {
+	URL    string `json:"url"`
+	Id     string `json:"id"`
+	Text   string `json:"text"`
+	Lang   string `json:"lang"`
+	Author struct {
+		Name       string `json:"name"`
+		ScreenName string `json:"screen_name"`
+		AvatarURL  string `json:"avatar_url"`
+	} `json:"author"`
+	CreatedTimestamp int64 `json:"created_timestamp"`
+	Media            *struct {
+		All []struct {
+			Type         string `json:"type"`
+			URL          string `json:"url"`
+			ThumbnailURL string `json:"thumbnail_url"`
+		} `json:"all"`
+	} `json:"media"`
+	Quote *fxTwitterTweet `json:"quote"`
+}
+
+func (f *fxTwitterFetcher) name() string {
+	return "FxTwitter"
+}
+
+func (t *fxTwitterTweet) toTweet() *tweet {
+	result := &tweet{
+		Id:       t.Id,
+		URL:      t.URL,
+		Author:   tweetAuthor{Name: t.Author.Name, ScreenName: t.Author.ScreenName, AvatarURL: t.Author.AvatarURL},
+		Text:     t.Text,
+		Language: strings.ToUpper(t.Lang),
+	}
+	// Some tweets come without a timestamp, and then they are embedded without
+	// one rather than as sent in 1970.
+	if t.CreatedTimestamp != 0 {
+		result.Created = time.Unix(t.CreatedTimestamp, 0)
+	}
+	if t.Media != nil {
+		for _, media := range t.Media.All {
+			result.Media = append(result.Media, tweetMedia{Type: media.Type, URL: media.URL, ThumbnailURL: media.ThumbnailURL})
+		}
+	}
+	if t.Quote != nil {
+		result.Quoted = t.Quote.toTweet()
+	}
+	return result
+}
+
+func (f *fxTwitterFetcher) fetch(id, URL string) (*tweet, error) {
+	body, err := web.get(fmt.Sprintf("%s/status/%s", strings.TrimSuffix(f.url, "/"), id), tweetCacheTTL)
+	if err != nil {
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == 404 {
+			return nil, errTweetNotFound
+		}
+		return nil, err
+	}
+	var response struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Tweet   *fxTwitterTweet `json:"tweet"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.Tweet == nil {
+		return nil, fmt.Errorf("FxTwitter returned %d: %s", response.Code, response.Message)
+	}
+	return response.Tweet.toTweet(), nil
+}
+
+// syndicationFetcher reads tweets from the endpoint behind Twitter's embedded
+// tweets.
+type syndicationFetcher struct{}
+
+type syndicationTweet struct {
+	IdStr     string `json:"id_str"`
+	Text      string `json:"text"`
+	Lang      string `json:"lang"`
+	CreatedAt string `json:"created_at"`
+	User      struct {
+		Name                 string `json:"name"`
+		ScreenName           string `json:"screen_name"`
+		ProfileImageURLHTTPS string `json:"profile_image_url_https"`
+	} `json:"user"`
+	MediaDetails []struct {
+		Type          string `json:"type"`
+		MediaURLHTTPS string `json:"media_url_https"`
+		VideoInfo     *struct {
+			Variants []struct {
+				ContentType string `json:"content_type"`
+				URL         string `json:"url"`
+			} `json:"variants"`
+		} `json:"video_info"`
+	} `json:"mediaDetails"`
+	QuotedTweet *syndicationTweet `json:"quoted_tweet"`
+}
+
+func (f *syndicationFetcher) name() string {
+	return "syndication"
+}
+
+// syndicationToken computes the token the embed widget sends along with the
+// tweet ID: (id / 1e15 * π).toString(36) without zeros or the point. The
+// digits are generated the way JavaScript does, which stops as soon as they
+// identify the number.
+func syndicationToken(id string) (string, error) {
+	number, err := strconv.ParseFloat(id, 64)
+	if err != nil {
+		return "", err
+	}
+	value := number / 1e15 * math.Pi
+	integer := math.Floor(value)
+	fraction := value - integer
+	delta := max(0.5*(math.Nextafter(value, math.Inf(1))-value), math.SmallestNonzeroFloat64)
+	var digits []int
+	for fraction >= delta {
+		fraction *= 36
+		delta *= 36
+		digit := int(fraction)
+		digits = append(digits, digit)
+		fraction -= float64(digit)
+		if (fraction > 0.5 || fraction == 0.5 && digit%2 == 1) && fraction+delta > 1 {
+			// Round up, carrying into the previous digits.
+			for {
+				if len(digits) == 0 {
+					integer++
+					break
+				}
+				last := len(digits) - 1
+				if digits[last]+1 < 36 {
+					digits[last]++
+					break
+				}
+				digits = digits[:last]
+			}
+			break
+		}
+	}
+	token := strconv.FormatUint(uint64(integer), 36)
+	for _, digit := range digits {
+		token += strconv.FormatInt(int64(digit), 36)
+	}
+	return strings.ReplaceAll(token, "0", ""), nil
+}
+
+func (t *syndicationTweet) toTweet() *tweet {
+	result := &tweet{
+		Id:       t.IdStr,
+		URL:      fmt.Sprintf("https://x.com/%s/status/%s", t.User.ScreenName, t.IdStr),
+		Author:   tweetAuthor{Name: t.User.Name, ScreenName: t.User.ScreenName, AvatarURL: t.User.ProfileImageURLHTTPS},
+		Text:     t.Text,
+		Language: strings.ToUpper(t.Lang),
+	}
+	result.Created, _ = time.Parse(time.RFC3339, t.CreatedAt)
+	for _, media := range t.MediaDetails {
+		item := tweetMedia{Type: media.Type, URL: media.MediaURLHTTPS, ThumbnailURL: media.MediaURLHTTPS}
+		if media.Type == "animated_gif" {
+			item.Type = "gif"
+		}
+		if media.VideoInfo != nil {
+			for _, variant := range media.VideoInfo.Variants {
+				if variant.ContentType == "video/mp4" {
+					item.URL = variant.URL
+				}
+			}
+		}
+		result.Media = append(result.Media, item)
+	}
+	if t.QuotedTweet != nil {
+		result.Quoted = t.QuotedTweet.toTweet()
+	}
+	return result
+}
+
+func (f *syndicationFetcher) fetch(id, URL string) (*tweet, error) {
+	token, err := syndicationToken(id)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"id": {id}, "token": {token}, "lang": {"en"}}
+	body, err := web.get("https://cdn.syndication.twimg.com/tweet-result?"+query.Encode(), tweetCacheTTL)
+	if err != nil {
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == 404 {
+			return nil, errTweetNotFound
+		}
+		return nil, err
+	}
+	var response syndicationTweet
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.IdStr == "" {
+		// Tombstones and tweets that need a login come without an ID.
+		return nil, errTweetNotFound
+	}
+	return response.toTweet(), nil
+}
+
+// browserTweetFetcher renders the tweet in the headless browser and reads it
+// from the page. It is the slowest and the most fragile of the fetchers, so it
+// is only used when the others fail.
+type browserTweetFetcher struct{}
+
+func (f *browserTweetFetcher) name() string {
+	return "browser"
+}
+
+func (f *browserTweetFetcher) fetch(id, URL string) (*tweet, error) {
+	result := &tweet{Id: id, URL: URL}
+	if match := tweetURLRegex.FindStringSubmatch(URL); match != nil {
+		result.Author.ScreenName = match[1]
+	}
+	err := browsers.withPage(URL, pageTimeout, func(page *rod.Page) error {
+		if err := page.WaitDOMStable(time.Second, 0); err != nil {
+			return err
+		}
+		// The first tweet on the page is the one the URL points to. The ones
+		// after it are replies.
+		article, err := page.Element(`article[data-testid="tweet"]`)
+		if err != nil {
+			return err
+		}
+		// Element waits for the selector to show up, Has does not.
+		if found, name, _ := article.Has(`[data-testid="User-Name"] span`); found {
+			result.Author.Name, _ = name.Text()
+		}
+		if found, avatar, _ := article.Has(`[data-testid="Tweet-User-Avatar"] img`); found {
+			if src, _ := avatar.Attribute("src"); src != nil {
+				result.Author.AvatarURL = *src
+			}
+		}
+		texts, err := article.Elements(`[data-testid="tweetText"]`)
+		if err != nil {
+			return err
+		}
+		// Tweets with only media have no text.
+		if len(texts) > 0 {
+			if result.Text, err = texts[0].Text(); err != nil {
+				return err
+			}
+			if lang, _ := texts[0].Attribute("lang"); lang != nil {
+				result.Language = strings.ToUpper(*lang)
+			}
+		}
+		if len(texts) > 1 {
+			result.Quoted = &tweet{}
+			result.Quoted.Text, _ = texts[1].Text()
+		}
+		photos, err := article.Elements(`[data-testid="tweetPhoto"] img`)
+		if err != nil {
+			return err
+		}
+		for _, photo := range photos {
+			if src, _ := photo.Attribute("src"); src != nil {
+				result.Media = append(result.Media, tweetMedia{Type: "photo", URL: *src, ThumbnailURL: *src})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fallbackTweetFetcher tries its fetchers in order until one of them works.
+type fallbackTweetFetcher struct {
+	fetchers []tweetFetcher
+}
+
+func (f *fallbackTweetFetcher) name() string {
+	names := make([]string, len(f.fetchers))
+	for i, fetcher := range f.fetchers {
+		names[i] = fetcher.name()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (f *fallbackTweetFetcher) fetch(id, URL string) (*tweet, error) {
+	var errs []error
+	for _, fetcher := range f.fetchers {
+		result, err := fetcher.fetch(id, URL)
+		if err == nil {
+			logger.Printf("Fetched tweet %s with %s\n", id, fetcher.name())
+			return result, nil
+		}
+		logger.Printf("Fetching tweet %s with %s failed, trying the next one: %v\n", id, fetcher.name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", fetcher.name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// newTweetFetcher builds the fetchers in the order they are tried. FXTWITTER_URL
+// overrides the FxTwitter instance.
+func newTweetFetcher() tweetFetcher {
+	fxTwitterURL := "https://api.fxtwitter.com"
+	getToken(&fxTwitterURL, "FXTWITTER_URL")
+	return &fallbackTweetFetcher{fetchers: []tweetFetcher{
+		&fxTwitterFetcher{url: fxTwitterURL},
+		&syndicationFetcher{},
+		&browserTweetFetcher{},
+	}}
+}
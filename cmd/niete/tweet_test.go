@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyndicationToken(t *testing.T) {
+	// Generated with ((id / 1e15) * Math.PI).toString(36).replace(/(0+|\.)/g, "").
+	tests := map[string]string{
+		"1":                   "bhi2ay3f28n",
+		"20":                  "6dq1a2xwd93",
+		"463440424141459456":  "14fxvks611f",
+		"1234567890123456789": "2zqic77uqyk",
+		"1752758843474563411": "48ygcs3x376",
+		"1866136532394307744": "4iun2i4t6uv",
+	}
+	for id, want := range tests {
+		if got, err := syndicationToken(id); err != nil || got != want {
+			t.Errorf("syndicationToken(%s) = %q, %v, want %q", id, got, err, want)
+		}
+	}
+	if _, err := syndicationToken("not a tweet"); err == nil {
+		t.Error("syndicationToken accepted an invalid ID")
+	}
+}
+
+func TestFxTwitterCreated(t *testing.T) {
+	tests := map[int64]time.Time{
+		0:          {},
+		1700000000: time.Unix(1700000000, 0),
+	}
+	for timestamp, want := range tests {
+		fxTweet := &fxTwitterTweet{CreatedTimestamp: timestamp}
+		if got := fxTweet.toTweet().Created; !got.Equal(want) || got.IsZero() != want.IsZero() {
+			t.Errorf("created_timestamp %d became %v, want %v", timestamp, got, want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ranks that split the crews into brackets after the preliminaries.
+var rankTiers = []int64{2000, 20000}
+
+type watchedCrew struct {
+	GuildId  string    `bson:"guildId"`
+	Channel  string    `bson:"channel"`
+	CrewId   string    `bson:"crewId"`
+	Name     string    `bson:"name"`
+	Added    time.Time `bson:"added"`
+	Polled   bool      `bson:"polled"`
+	LastRank int64     `bson:"lastRank"`
+	LastTier int       `bson:"lastTier"`
+	Ahead    bool      `bson:"ahead"`
+}
+
+// rankTier returns the index of the bracket the rank falls in.
+func rankTier(rank int64) int {
+	for i, tier := range rankTiers {
+		if rank <= tier {
+			return i
+		}
+	}
+	return len(rankTiers)
+}
+
+func tierName(tier int) string {
+	if tier < len(rankTiers) {
+		return "top " + intComma(int(rankTiers[tier]))
+	}
+	return "outside the top " + intComma(int(rankTiers[len(rankTiers)-1]))
+}
+
+// latestRound returns the most recent row of the rounds returned by
+// getLastRoundsPerformance. Total honors only grow during a GW, so that is the
+// one with the most of them.
+func latestRound(rounds [][]string) []string {
+	var latest []string
+	var latestTotal int64 = -1
+	for _, round := range rounds {
+		_, _, total := parseRound(round)
+		if total > latestTotal {
+			latest, latestTotal = round, total
+		}
+	}
+	return latest
+}
+
+// crewIdAndName extracts the ID and the most recent name of a crew returned
+// by searchCrews.
+func crewIdAndName(crew any) (string, string) {
+	crewMap := crew.(map[string]any)
+	crewId := fmt.Sprintf("%.f", crewMap["id"].(float64))
+	name := crewId
+	if crewData, ok := crewMap["data"].([]any); ok {
+		for _, gwData := range crewData {
+			if gwName, ok := gwData.(map[string]any)["name"].(string); ok && gwName != "" {
+				name = gwName
+				break
+			}
+		}
+	}
+	return crewId, name
+}
+
+func getWatchlist(filter bson.M) ([]watchedCrew, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := getDatabase().Collection("watchlist").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var watchlist []watchedCrew
+	err = cursor.All(ctx, &watchlist)
+	return watchlist, err
+}
+
+func watchCrew(session *dgo.Session, channel, guild string, args []string) error {
+	if len(args) == 0 {
+		watchlist, err := getWatchlist(bson.M{"guildId": guild})
+		if err != nil {
+			return err
+		}
+		if len(watchlist) == 0 {
+			_, err = session.ChannelMessageSend(channel, "No crews are being watched. Use `$gw watch <crew>`.")
+			return err
+		}
+		message := "Watched crews:\n"
+		for _, crew := range watchlist {
+			message += fmt.Sprintf("- %s (`%s`)", crew.Name, crew.CrewId)
+			if crew.Polled {
+				message += fmt.Sprintf(", rank #%s", intComma(int(crew.LastRank)))
+			}
+			message += "\n"
+		}
+		_, err = session.ChannelMessageSend(channel, message)
+		return err
+	}
+	crews, err := searchCrews(strings.Join(args, " "))
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	if len(crews) == 0 {
+		_, err = session.ChannelMessageSend(channel, "Crew not found.")
+		return err
+	}
+	crewId, name := crewIdAndName(crews[0])
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = getDatabase().Collection("watchlist").UpdateOne(
+		ctx,
+		bson.M{"guildId": guild, "crewId": crewId},
+		bson.M{
+			"$set":         bson.M{"channel": channel, "name": name},
+			"$setOnInsert": bson.M{"added": time.Now(), "polled": false},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		session.ChannelMessageSend(channel, "Sorry, something went wrong.")
+		return err
+	}
+	_, err = session.ChannelMessageSend(channel, fmt.Sprintf("Watching %s (`%s`). Alerts will be posted here.", name, crewId))
+	return err
+}
+
+func unwatchCrew(session *dgo.Session, channel, guild string, args []string) error {
+	if len(args) == 0 {
+		_, err := session.ChannelMessageSend(channel, "Usage: `$gw unwatch <crew>`")
+		return err
+	}
+	crew := strings.Join(args, " ")
+	watchlist, err := getWatchlist(bson.M{"guildId": guild})
+	if err != nil {
+		return err
+	}
+	for _, watched := range watchlist {
+		if watched.CrewId != crew && !strings.EqualFold(watched.Name, crew) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = getDatabase().Collection("watchlist").DeleteOne(ctx, bson.M{"guildId": guild, "crewId": watched.CrewId})
+		if err != nil {
+			return err
+		}
+		_, err = session.ChannelMessageSend(channel, fmt.Sprintf("No longer watching %s.", watched.Name))
+		return err
+	}
+	_, err = session.ChannelMessageSend(channel, "That crew is not being watched.")
+	return err
+}
+
+// watchAlerts compares the latest round of a watched crew with the last time
+// it was polled and with our own crew, and returns the alerts to post.
+func watchAlerts(crew *watchedCrew, round, ourRound []string) []string {
+	var alerts []string
+	rank, daily, _ := parseRound(round)
+	tier := rankTier(rank)
+	if crew.Polled && tier != crew.LastTier {
+		direction := "climbed"
+		if tier > crew.LastTier {
+			direction = "dropped"
+		}
+		alerts = append(alerts, fmt.Sprintf(
+			"%s %s to rank #%s and is now %s.",
+			crew.Name, direction, intComma(int(rank)), tierName(tier),
+		))
+	}
+	if ourRound != nil {
+		ourRank, ourDaily, _ := parseRound(ourRound)
+		ourTier := rankTier(ourRank)
+		if crew.Polled && tier == ourTier && crew.LastTier != ourTier {
+			alerts = append(alerts, fmt.Sprintf(
+				"%s is in our bracket (%s) with rank #%s.",
+				crew.Name, tierName(tier), intComma(int(rank)),
+			))
+		}
+		ahead := daily > ourDaily
+		if ahead && !crew.Ahead && round[0] == ourRound[0] {
+			alerts = append(alerts, fmt.Sprintf(
+				"%s overtook us in daily honors: %s vs our %s.",
+				crew.Name, intComma(int(daily)), intComma(int(ourDaily)),
+			))
+		}
+		crew.Ahead = ahead
+	}
+	crew.Polled = true
+	crew.LastRank = rank
+	crew.LastTier = tier
+	return alerts
+}
+
+// pollWatchlist checks every watched crew and posts alerts in the channel
+// where it was watched.
+func pollWatchlist(session *dgo.Session) error {
+	watchlist, err := getWatchlist(bson.M{})
+	if err != nil {
+		return err
+	}
+	// The latest round of the home crew of each watcher, by crew ID.
+	ourRounds := make(map[string][]string)
+	for _, crew := range watchlist {
+		rounds, err := getLastRoundsPerformance(crew.CrewId)
+		if err != nil {
+			logger.Printf("Could not poll watched crew %s: %v\n", crew.CrewId, err)
+			continue
+		}
+		ourCrew := homeCrew(crew.GuildId, crew.Channel)
+		ourRound, ok := ourRounds[ourCrew]
+		if !ok && ourCrew != "" {
+			if rounds, err := getLastRoundsPerformance(ourCrew); err != nil {
+				logger.Printf("Could not get our last rounds for the watchlist: %v\n", err)
+			} else {
+				ourRound = latestRound(rounds)
+			}
+			ourRounds[ourCrew] = ourRound
+		}
+		round := latestRound(rounds)
+		if round == nil {
+			continue
+		}
+		for _, alert := range watchAlerts(&crew, round, ourRound) {
+			session.ChannelMessageSend(crew.Channel, ":rotating_light: "+alert)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = getDatabase().Collection("watchlist").UpdateOne(
+			ctx,
+			bson.M{"guildId": crew.GuildId, "crewId": crew.CrewId},
+			bson.M{"$set": bson.M{
+				"polled":   crew.Polled,
+				"lastRank": crew.LastRank,
+				"lastTier": crew.LastTier,
+				"ahead":    crew.Ahead,
+			}},
+		)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRankTier(t *testing.T) {
+	tests := []struct {
+		rank int64
+		want int
+	}{
+		{rank: 1, want: 0},
+		{rank: 2000, want: 0},
+		{rank: 2001, want: 1},
+		{rank: 20000, want: 1},
+		{rank: 20001, want: 2},
+	}
+	for _, test := range tests {
+		if got := rankTier(test.rank); got != test.want {
+			t.Errorf("rankTier(%d) = %d, want %d", test.rank, got, test.want)
+		}
+	}
+}
+
+func TestLatestRound(t *testing.T) {
+	rounds := [][]string{
+		{"Mar 13", "2100", "10,000", "50,000"},
+		{"Mar 14", "1900", "20,000", "70,000"},
+		{"Mar 12", "2500", "40,000", "40,000"},
+	}
+	if got := latestRound(rounds); got[0] != "Mar 14" {
+		t.Errorf("got %q", got)
+	}
+	if got := latestRound(nil); got != nil {
+		t.Errorf("got %q without rounds", got)
+	}
+}
+
+func TestWatchAlerts(t *testing.T) {
+	tests := []struct {
+		name      string
+		crew      watchedCrew
+		round     []string
+		ourRound  []string
+		want      []string
+		wantAhead bool
+	}{
+		{
+			name:  "first poll",
+			crew:  watchedCrew{Name: "Rivals"},
+			round: []string{"Mar 14", "1500", "100", "1000"},
+		},
+		{
+			name:  "same bracket",
+			crew:  watchedCrew{Name: "Rivals", Polled: true, LastTier: 0},
+			round: []string{"Mar 14", "1500", "100", "1000"},
+		},
+		{
+			name:  "dropped",
+			crew:  watchedCrew{Name: "Rivals", Polled: true, LastTier: 0},
+			round: []string{"Mar 14", "2500", "100", "1000"},
+			want:  []string{"Rivals dropped to rank #2,500 and is now top 20,000."},
+		},
+		{
+			name:     "climbed into our bracket",
+			crew:     watchedCrew{Name: "Rivals", Polled: true, LastTier: 2},
+			round:    []string{"Mar 14", "1999", "100", "1000"},
+			ourRound: []string{"Mar 14", "1000", "200", "2000"},
+			want: []string{
+				"Rivals climbed to rank #1,999 and is now top 2,000.",
+				"Rivals is in our bracket (top 2,000) with rank #1,999.",
+			},
+		},
+		{
+			name:      "overtook us",
+			crew:      watchedCrew{Name: "Rivals", Polled: true, LastTier: 0},
+			round:     []string{"Mar 14", "1500", "300", "1000"},
+			ourRound:  []string{"Mar 14", "1000", "200", "2000"},
+			want:      []string{"Rivals overtook us in daily honors: 300 vs our 200."},
+			wantAhead: true,
+		},
+		{
+			name:      "still ahead",
+			crew:      watchedCrew{Name: "Rivals", Polled: true, LastTier: 0, Ahead: true},
+			round:     []string{"Mar 14", "1500", "300", "1000"},
+			ourRound:  []string{"Mar 14", "1000", "200", "2000"},
+			wantAhead: true,
+		},
+		{
+			// Their results for today against ours for yesterday.
+			name:      "different days",
+			crew:      watchedCrew{Name: "Rivals", Polled: true, LastTier: 0},
+			round:     []string{"Mar 14", "1500", "300", "1000"},
+			ourRound:  []string{"Mar 13", "1000", "200", "2000"},
+			wantAhead: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crew := test.crew
+			got := watchAlerts(&crew, test.round, test.ourRound)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			rank, _, _ := parseRound(test.round)
+			if !crew.Polled || crew.LastRank != rank || crew.LastTier != rankTier(rank) || crew.Ahead != test.wantAhead {
+				t.Errorf("left the crew as %+v", crew)
+			}
+		})
+	}
+}
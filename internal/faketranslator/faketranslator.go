@@ -0,0 +1,119 @@
+// Package faketranslator serves the translation APIs Niete supports with
+// canned answers, so the translation flow can be tried and tested without
+// network access or API keys.
+//
+// Text with non-ASCII characters is detected as Japanese and everything else
+// as English. The translation is the text with a "[EN]" prefix, or whatever
+// the target language is.
+package faketranslator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Options makes the fake APIs fail, to check that the bot moves on to the
+// next backend.
+type Options struct {
+	// Answer every DeepL request with 456 Quota Exceeded.
+	DeepLQuotaExceeded bool
+	// Answer every LibreTranslate request with 503.
+	LibreTranslateDown bool
+}
+
+// Handler serves DeepL at /v2/translate, LibreTranslate at /translate and
+// DeepLX at /deeplx/translate. The options are read on every request, so they
+// can be changed while it runs.
+func Handler(options *Options) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v2/translate", options.deepl)
+	mux.HandleFunc("POST /translate", options.libreTranslate)
+	mux.HandleFunc("POST /deeplx/translate", deeplx)
+	return mux
+}
+
+func detectLanguage(text string) string {
+	for _, r := range text {
+		if r > unicode.MaxASCII {
+			return "JA"
+		}
+	}
+	return "EN"
+}
+
+func fakeTranslation(text, target string) string {
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(target), text)
+}
+
+func writeJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Println("Could not write the response:", err)
+	}
+}
+
+func (o *Options) deepl(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "DeepL-Auth-Key ") {
+		http.Error(w, "missing DeepL-Auth-Key", http.StatusForbidden)
+		return
+	}
+	if o.DeepLQuotaExceeded {
+		http.Error(w, "Quota exceeded", 456)
+		return
+	}
+	var request struct {
+		Text       []string `json:"text"`
+		TargetLang string   `json:"target_lang"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Text) == 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	translations := make([]map[string]string, len(request.Text))
+	for i, text := range request.Text {
+		translations[i] = map[string]string{
+			"detected_source_language": detectLanguage(text),
+			"text":                     fakeTranslation(text, request.TargetLang),
+		}
+	}
+	writeJSON(w, map[string]any{"translations": translations})
+}
+
+func (o *Options) libreTranslate(w http.ResponseWriter, r *http.Request) {
+	if o.LibreTranslateDown {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var request struct {
+		Q      string `json:"q"`
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"translatedText":   fakeTranslation(request.Q, request.Target),
+		"detectedLanguage": map[string]any{"language": strings.ToLower(detectLanguage(request.Q)), "confidence": 90},
+	})
+}
+
+func deeplx(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Text       string `json:"text"`
+		TargetLang string `json:"target_lang"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"code":        http.StatusOK,
+		"data":        fakeTranslation(request.Text, request.TargetLang),
+		"source_lang": detectLanguage(request.Text),
+	})
+}